@@ -13,19 +13,69 @@ import (
   "adventOfCode2024/util"
 )
 
-func printRules(r map[string][]string) {
-  for k, v := range r {
-    fmt.Printf("Page %v comes before pages %v\n", k, strings.Join(v, ","))
+type options struct {
+  broken bool
+  cycles bool
+}
+
+// ruleGraph has an edge from every page to the pages that have to come
+// after it
+type ruleGraph struct {
+  pages []int
+  after map[int][]int
+  edges map[[2]int]bool
+}
+
+func newRuleGraph() *ruleGraph {
+  return &ruleGraph{after: make(map[int][]int), edges: make(map[[2]int]bool)}
+}
+
+func (g *ruleGraph) addRule(before, after int) {
+  if g.edges[[2]int{before, after}] {
+    return
+  }
+  for _, p := range []int{before, after} {
+    if _, ok := g.after[p]; !ok {
+      g.after[p] = []int{}
+      g.pages = append(g.pages, p)
+    }
+  }
+  g.after[before] = append(g.after[before], after)
+  g.edges[[2]int{before, after}] = true
+}
+
+func (g *ruleGraph) mustPrecede(before, after int) bool {
+  return g.edges[[2]int{before, after}]
+}
+
+func printRules(g *ruleGraph) {
+  for _, p := range g.pages {
+    if len(g.after[p]) == 0 {
+      continue
+    }
+    fmt.Printf("Page %d comes before pages %v\n", p, g.after[p])
+  }
+}
+
+func parsePages(line string, sep string) ([]int, error) {
+  var result []int
+  for _, field := range strings.Split(line, sep) {
+    page, err := strconv.Atoi(field)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid page number %q in %q", field, line)
+    }
+    result = append(result, page)
   }
+  return result, nil
 }
 
-func readInput(path string) (map[string][]string, [][]string, error) {
-  rules := make(map[string][]string)
-  var pages [][]string
+func readInput(path string) (*ruleGraph, [][]int, error) {
+  rules := newRuleGraph()
+  var updates [][]int
   file, err := os.Open(path)
   defer file.Close()
   if err != nil {
-    return rules, pages, err
+    return rules, updates, err
   }
   scanner := bufio.NewScanner(file)
   for scanner.Scan() {
@@ -33,101 +83,200 @@ func readInput(path string) (map[string][]string, [][]string, error) {
     if line == "" {
       break
     }
-    elements := strings.Split(line, "|")
-    _, ok := rules[elements[0]]
-    if !ok {
-      rules[elements[0]] = []string{}
+    pages, err := parsePages(line, "|")
+    if err != nil {
+      return rules, updates, err
+    }
+    if len(pages) != 2 {
+      return rules, updates, fmt.Errorf("Invalid rule %q", line)
     }
-    rules[elements[0]] = append(rules[elements[0]], elements[1])
+    rules.addRule(pages[0], pages[1])
   }
   for scanner.Scan() {
     line := scanner.Text()
-    pages = append(pages, strings.Split(line, ","))
+    if line == "" {
+      continue
+    }
+    update, err := parsePages(line, ",")
+    if err != nil {
+      return rules, updates, err
+    }
+    updates = append(updates, update)
   }
-  return rules, pages, nil
+  return rules, updates, nil
 }
 
-func isPageValid(rules map[string][]string, page []string) bool {
-  for i, p := range page {
-    for _, pt := range page[i:] {
-      if slices.Contains(rules[pt], p){
-        return false
+// brokenRules lists every rule that an update breaks as a before, after
+// pair, the update is valid when there are none
+func brokenRules(rules *ruleGraph, update []int) [][2]int {
+  var result [][2]int
+  for i := range update {
+    for j := i + 1; j < len(update); j++ {
+      if rules.mustPrecede(update[j], update[i]) {
+        result = append(result, [2]int{update[j], update[i]})
       }
     }
   }
-  return true
+  return result
 }
 
-func fixPage(rules map[string][]string, page []string) []string {
-  fixedPage := make([]string, len(page))
-  for i := 0; i < len(fixedPage); i++ {
-    for j := 0; j < len(page); j++ {
-      broken := false
-      for k := 0; k < len(page); k++ {
-        if j == k {
-          continue
-        }
-        if slices.Contains(rules[page[k]], page[j]) {
-          broken = true
-          break
+// findCycle looks for a cycle among pages using only the rules between
+// them, it returns the pages of the cycle with the first page repeated
+func findCycle(rules *ruleGraph, pages []int) []int {
+  const (
+    unvisited = iota
+    onStack
+    done
+  )
+  state := make(map[int]int, len(pages))
+  inPages := make(map[int]bool, len(pages))
+  for _, p := range pages {
+    inPages[p] = true
+  }
+  var stack []int
+  var visit func(p int) []int
+  visit = func(p int) []int {
+    state[p] = onStack
+    stack = append(stack, p)
+    for _, next := range rules.after[p] {
+      if !inPages[next] {
+        continue
+      }
+      switch state[next] {
+      case onStack:
+        start := slices.Index(stack, next)
+        return append(slices.Clone(stack[start:]), next)
+      case unvisited:
+        if cycle := visit(next); cycle != nil {
+          return cycle
         }
       }
-      if !broken {
-        fixedPage[i] = page[j]
-        page = slices.Delete(page, j, j+1)
-        break
+    }
+    stack = stack[:len(stack)-1]
+    state[p] = done
+    return nil
+  }
+  for _, p := range pages {
+    if state[p] != unvisited {
+      continue
+    }
+    if cycle := visit(p); cycle != nil {
+      return cycle
+    }
+  }
+  return nil
+}
+
+func formatCycle(cycle []int) string {
+  pages := make([]string, len(cycle))
+  for i, p := range cycle {
+    pages[i] = strconv.Itoa(p)
+  }
+  return strings.Join(pages, " -> ")
+}
+
+// orderPages sorts pages with Kahn's algorithm on the rules between them,
+// pages that are free to go next keep the order they had before
+func orderPages(rules *ruleGraph, pages []int) ([]int, error) {
+  inPages := make(map[int]bool, len(pages))
+  for _, p := range pages {
+    inPages[p] = true
+  }
+  inDegree := make(map[int]int, len(pages))
+  for _, p := range pages {
+    for _, next := range rules.after[p] {
+      if inPages[next] {
+        inDegree[next]++
+      }
+    }
+  }
+  var queue []int
+  for _, p := range pages {
+    if inDegree[p] == 0 {
+      queue = append(queue, p)
+    }
+  }
+  result := make([]int, 0, len(pages))
+  for len(queue) > 0 {
+    p := queue[0]
+    queue = queue[1:]
+    result = append(result, p)
+    for _, next := range rules.after[p] {
+      if !inPages[next] {
+        continue
+      }
+      inDegree[next]--
+      if inDegree[next] == 0 {
+        queue = append(queue, next)
       }
     }
   }
-  return fixedPage
+  if len(result) < len(pages) {
+    remaining := slices.DeleteFunc(slices.Clone(pages), func(p int) bool {
+      return slices.Contains(result, p)
+    })
+    return nil, fmt.Errorf("Rules for pages %v have a cycle: %s", pages, formatCycle(findCycle(rules, remaining)))
+  }
+  return result, nil
 }
 
-func task1(rules map[string][]string, pages [][]string, debug bool) {
-  var validPages [][]string
+func task1(rules *ruleGraph, updates [][]int, debug bool, opts options) {
+  var validUpdates [][]int
   result := 0
-  for _, p := range pages {
-    if isPageValid(rules, p) {
-      validPages = append(validPages, p)
+  for _, u := range updates {
+    if len(brokenRules(rules, u)) == 0 {
+      validUpdates = append(validUpdates, u)
     }
   }
   if debug {
-    fmt.Printf("Valid pages: %v\n", validPages)
+    fmt.Printf("Valid pages: %v\n", validUpdates)
   }
-  for _, p := range validPages {
-    middle, _ := strconv.Atoi(p[(len(p)-1)/2])
-    result += middle
+  for _, u := range validUpdates {
+    result += u[(len(u)-1)/2]
   }
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(rules map[string][]string, pages [][]string, debug bool) {
-  var invalidPages [][]string
+func task2(rules *ruleGraph, updates [][]int, debug bool, opts options) error {
+  var invalidUpdates [][]int
   result := 0
-  for _, p := range pages {
-    if !isPageValid(rules, p) {
-      invalidPages = append(invalidPages, p)
+  for _, u := range updates {
+    broken := brokenRules(rules, u)
+    if len(broken) == 0 {
+      continue
+    }
+    invalidUpdates = append(invalidUpdates, u)
+    if opts.broken {
+      pairs := make([]string, len(broken))
+      for i, b := range broken {
+        pairs[i] = fmt.Sprintf("%d|%d", b[0], b[1])
+      }
+      fmt.Printf("Update %v breaks rules %s\n", u, strings.Join(pairs, ", "))
     }
   }
   if debug {
-    fmt.Printf("Invalid pages: %v\n", invalidPages)
+    fmt.Printf("Invalid pages: %v\n", invalidUpdates)
   }
-
-  fixedPages := make([][]string, len(invalidPages))
-  for i, ip := range invalidPages {
-    fixedPages[i] = fixPage(rules, ip)
+  fixedUpdates := make([][]int, len(invalidUpdates))
+  for i, u := range invalidUpdates {
+    fixed, err := orderPages(rules, u)
+    if err != nil {
+      return err
+    }
+    fixedUpdates[i] = fixed
   }
   if debug {
-    fmt.Printf("Fixed pages: %v\n", fixedPages)
+    fmt.Printf("Fixed pages: %v\n", fixedUpdates)
   }
-  for _, p := range fixedPages {
-    middle, _ := strconv.Atoi(p[(len(p)-1)/2])
-    result += middle
+  for _, u := range fixedUpdates {
+    result += u[(len(u)-1)/2]
   }
   fmt.Printf("Task 2: %d\n", result)
+  return nil
 }
 
-func Run(path string, taskId int, debug bool) error {
-  rules, pages, err := readInput(path)
+func Run(path string, taskId int, debug bool, opts options) error {
+  rules, updates, err := readInput(path)
   if err != nil {
     return err
   }
@@ -136,17 +285,26 @@ func Run(path string, taskId int, debug bool) error {
     fmt.Println("Starting rules:")
     printRules(rules)
     fmt.Println("Starting pages:")
-    fmt.Println(pages)
+    fmt.Println(updates)
+  }
+  if opts.cycles && taskId == 1 {
+    // The rules only have to be ordered within every update, so a cycle
+    // over all pages is reported but doesn't stop the tasks
+    if cycle := findCycle(rules, rules.pages); cycle != nil {
+      fmt.Printf("Rules have a cycle: %s\n", formatCycle(cycle))
+    } else {
+      fmt.Println("Rules have no cycles")
+    }
   }
   switch taskId {
   case 1:
-    task1(rules, pages, debug)
+    task1(rules, updates, debug, opts)
   case 2:
-    task2(rules, pages, debug)
+    err = task2(rules, updates, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
-  return nil
+  return err
 }
 
 func main() {
@@ -155,9 +313,13 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  opts := options{
+    broken: slices.Contains(os.Args[1:], "--broken"),
+    cycles: slices.Contains(os.Args[1:], "--cycles"),
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
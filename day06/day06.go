@@ -4,22 +4,14 @@ import (
 	"bufio"
   "errors"
 	"fmt"
+	"image/color"
 	"os"
+	"slices"
 	"time"
 
   "adventOfCode2024/util"
 )
 
-type obstacle struct {
-  i int
-  j int
-  d rune
-}
-
-func newObstacle(i, j int, d rune) *obstacle {
-  return &obstacle{i: i, j: j, d: d}
-}
-
 func printData(d [][]rune) {
   for _, s := range d {
     fmt.Println(string(s))
@@ -56,169 +48,214 @@ func initGuard(data [][]rune) (int, int, rune){
   return 0, 0, 0
 }
 
-func nextDirection(direction rune) rune {
-  switch direction {
-  case rune('^'):
-    return rune('>')
-  case rune('>'):
-    return rune('v')
-  case rune('v'):
-    return rune('<')
-  case rune('<'):
-    return rune('^')
-  default:
-    fmt.Printf("Wrong direction %v\n", string(direction))
-    return 0
-  }
+var directions = []rune{rune('^'), rune('>'), rune('v'), rune('<')}
+
+type step struct {
+  i int
+  j int
+  d rune
 }
 
-func nextGuard(i, j int, direction rune) (int, int) {
-  switch direction {
-  case rune('^'):
-    return i-1, j
-  case rune('v'):
-    return i+1, j
-  case rune('>'):
-    return i, j+1
-  case rune('<'):
-    return i, j-1
-  default:
-    fmt.Printf("Wrong direction %v\n", string(direction))
-    return i, j
-  }
+// patrol simulates the guard without changing the grid, jump[d][i][j] is
+// the last cell the guard reaches walking from (i, j) in direction d before
+// hitting an obstacle, or -1 when the guard walks out of the grid
+type patrol struct {
+  grid   [][]rune
+  height int
+  width  int
+  start  step
+  jump   [4][]int
 }
 
-func countX(data [][]rune) int {
-  cnt := 0
-  for _, s := range data {
-    for _, c := range s {
-      switch c {
-      case rune('X'):
-        cnt += 1
+func newPatrol(data [][]rune) *patrol {
+  p := &patrol{grid: data, height: len(data), width: len(data[0])}
+  i, j, d := initGuard(data)
+  p.start = step{i: i, j: j, d: d}
+  for dIdx, d := range directions {
+    p.jump[dIdx] = make([]int, p.height*p.width)
+    di, dj := util.TranslateDirection(d)
+    // Cells are visited so the cell in front of the guard is always done first
+    for n := range p.height * p.width {
+      i, j := n/p.width, n%p.width
+      if di > 0 {
+        i = p.height - 1 - i
+      }
+      if dj > 0 {
+        j = p.width - 1 - j
+      }
+      nextI, nextJ := i+di, j+dj
+      switch {
+      case !p.inside(nextI, nextJ):
+        p.jump[dIdx][i*p.width+j] = -1
+      case p.grid[nextI][nextJ] == rune('#'):
+        p.jump[dIdx][i*p.width+j] = i*p.width + j
       default:
-        continue
+        p.jump[dIdx][i*p.width+j] = p.jump[dIdx][nextI*p.width+nextJ]
       }
     }
   }
-  return cnt
+  return p
 }
 
-func locateAllX(data [][]rune) [][]int {
-  var xLocations [][]int
-  for i, s := range data {
-    for j, c := range s {
-      switch c {
-      case rune('X'):
-        xLocations = append(xLocations, []int{i, j})
-      default:
-        continue
-      }
+func (p *patrol) inside(i, j int) bool {
+  return i >= 0 && i < p.height && j >= 0 && j < p.width
+}
+
+// Path walks the guard one step at a time until it leaves the grid, the
+// second result is false when the guard walks in a loop instead
+func (p *patrol) Path() ([]step, bool) {
+  seen := make([]bool, p.height*p.width*len(directions))
+  curr := p.start
+  var path []step
+  for {
+    state := (curr.i*p.width+curr.j)*len(directions) + slices.Index(directions, curr.d)
+    if seen[state] {
+      return path, false
     }
+    seen[state] = true
+    path = append(path, curr)
+    di, dj := util.TranslateDirection(curr.d)
+    nextI, nextJ := curr.i+di, curr.j+dj
+    if !p.inside(nextI, nextJ) {
+      return path, true
+    }
+    if p.grid[nextI][nextJ] == rune('#') {
+      curr.d = util.TurnRight(curr.d)
+      continue
+    }
+    curr.i, curr.j = nextI, nextJ
   }
-  return xLocations
 }
 
-func task1(data [][]rune, debug bool) {
-  iGurad, jGuard, dGuard := initGuard(data)
-  i := 0
-  j := 0
-  for i >= 0 && i < len(data) && j >= 0 && j < len(data[0]) {
-    iNext, jNext := nextGuard(iGurad, jGuard, dGuard)
-    if iNext < 0 || iNext >= len(data) || jNext < 0 || jNext >= len(data[0]) {
-      data[iGurad][jGuard] = rune('X')
-      if debug {
-        printData(data)
-      }
-      break
+// Loops checks if an extra obstacle at (oi, oj) traps the guard, the guard
+// jumps between the obstacles it hits and only those stops are remembered
+func (p *patrol) Loops(oi, oj int, seen []int, stamp int) bool {
+  curr := p.start
+  for {
+    dIdx := slices.Index(directions, curr.d)
+    state := (curr.i*p.width+curr.j)*len(directions) + dIdx
+    if seen[state] == stamp {
+      return true
     }
-    for x := 1; x < 4; x++ {
-      if data[iNext][jNext] != '#' {
-        break
+    seen[state] = stamp
+    target := p.jump[dIdx][curr.i*p.width+curr.j]
+    di, dj := util.TranslateDirection(curr.d)
+    // The extra obstacle stops the guard earlier if it is ahead on the way
+    ahead := (di != 0 && oj == curr.j && (oi-curr.i)*di > 0) || (dj != 0 && oi == curr.i && (oj-curr.j)*dj > 0)
+    if ahead {
+      distObstacle := abs(oi-curr.i) + abs(oj-curr.j)
+      if target == -1 || abs(target/p.width-curr.i)+abs(target%p.width-curr.j) >= distObstacle {
+        target = (oi-di)*p.width + (oj - dj)
       }
-      dGuard = nextDirection(dGuard)
-      iNext, jNext = nextGuard(iGurad, jGuard, dGuard)
     }
-    data[iNext][jNext] = dGuard
-    data[iGurad][jGuard] = rune('X')
-    iGurad = iNext
-    jGuard = jNext
-    if debug {
-      fmt.Printf("Guard is going to: (%d,%d) going %s\n", iNext, jNext, string(dGuard))
+    if target == -1 {
+      return false
     }
+    curr = step{i: target / p.width, j: target % p.width, d: util.TurnRight(curr.d)}
   }
-  result := countX(data)
-  fmt.Printf("Task 1: %d\n", result)
 }
 
-func containsObstacle(obstacleList []*obstacle, target *obstacle) bool {
-  for _, o := range obstacleList {
-    if o.d == target.d && o.i == target.i && o.j == target.j {
-      return true
-    }
+func abs(x int) int {
+  if x < 0 {
+    return -x
   }
-  return false
+  return x
 }
 
-func task2Traverse(data [][]rune, iGurad, jGuard int, dGuard rune, debug bool) bool {
-  var obstacleList []*obstacle
-  i := 0
-  j := 0
-  for i >= 0 && i < len(data) && j >= 0 && j < len(data[0]) {
-    iNext, jNext := nextGuard(iGurad, jGuard, dGuard)
-    if iNext < 0 || iNext >= len(data) || jNext < 0 || jNext >= len(data[0]) {
-      if debug {
-        printData(data)
-      }
-      break
-    }
-    for x := 1; x <= 2; x++ {
-      if data[iNext][jNext] != '#' {
-        break
-      }
-      newObs := newObstacle(iNext, jNext, dGuard)
-      if containsObstacle(obstacleList, newObs) {
-        return false
-      }
-      obstacleList = append(obstacleList, newObs)
-      dGuard = nextDirection(dGuard)
-      iNext, jNext = nextGuard(iGurad, jGuard, dGuard)
-    }
-    data[iNext][jNext] = dGuard
-    data[iGurad][jGuard] = rune('X')
-    iGurad = iNext
-    jGuard = jNext
-    if debug {
-      fmt.Printf("Guard is going to: (%d,%d) going %s\n", iNext, jNext, string(dGuard))
+// renderPath draws the path over a copy of the grid, cells the guard walked
+// through are marked with X and extra obstacles with O
+func renderPath(data [][]rune, path []step, obstacles [][]int) [][]rune {
+  result := make([][]rune, len(data))
+  for i := range data {
+    result[i] = slices.Clone(data[i])
+  }
+  for _, s := range path {
+    result[s.i][s.j] = rune('X')
+  }
+  for _, o := range obstacles {
+    result[o[0]][o[1]] = rune('O')
+  }
+  return result
+}
+
+func visitedCells(path []step, width int) [][]int {
+  seen := make(map[int]bool)
+  var result [][]int
+  for _, s := range path {
+    if seen[s.i*width+s.j] {
+      continue
     }
+    seen[s.i*width+s.j] = true
+    result = append(result, []int{s.i, s.j})
   }
-  return true
+  return result
 }
 
-func task2(data [][]rune, path string, debug bool) {
-  iGurad, jGuard, dGuard := initGuard(data)
+var palette = util.Palette{
+  rune('#'): color.RGBA{R: 90, G: 90, B: 90, A: 255},
+  rune('.'): color.RGBA{R: 15, G: 15, B: 35, A: 255},
+  rune('X'): color.RGBA{R: 40, G: 40, B: 90, A: 255},
+  rune('O'): color.RGBA{R: 220, G: 20, B: 60, A: 255},
+}
+
+func exportSVG(data [][]rune, path []step, obstacles [][]int) error {
+  outPath, err := util.OutputsPath("day06.svg")
+  if err != nil {
+    return err
+  }
+  points := make([]util.GridPoint, len(path))
+  for i, s := range path {
+    points[i] = util.GridPoint{Row: s.i, Col: s.j}
+  }
+  err = util.WriteGridSVG(outPath, renderPath(data, path, obstacles), palette, [][]util.GridPoint{points}, 8)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Guard path written to: %s\n", outPath)
+  return nil
+}
+
+func task1(data [][]rune, debug bool) {
+  p := newPatrol(data)
+  path, _ := p.Path()
   if debug {
-    fmt.Printf("Guard is located at: (%d,%d) going %s\n", iGurad, jGuard, string(dGuard))
+    printData(renderPath(data, path, nil))
   }
-  task1(data, debug)
-  xLocations := locateAllX(data)
-  result := 0
-  for _, xLoc := range xLocations {
-    cleanData, _ := readInput(path)
-    cleanData[xLoc[0]][xLoc[1]] = rune('#')
-    if !task2Traverse(cleanData, iGurad, jGuard, dGuard, debug) {
-      if debug {
-        fmt.Println("Solution:")
-        cleanData[xLoc[0]][xLoc[1]] = rune('O')
-        printData(cleanData)
-      }
-      result += 1
+  result := len(visitedCells(path, p.width))
+  fmt.Printf("Task 1: %d\n", result)
+}
+
+func task2(data [][]rune, debug bool, svg bool) {
+  p := newPatrol(data)
+  if debug {
+    fmt.Printf("Guard is located at: (%d,%d) going %s\n", p.start.i, p.start.j, string(p.start.d))
+  }
+  path, _ := p.Path()
+  seen := make([]int, p.height*p.width*len(directions))
+  var obstacles [][]int
+  for n, cell := range visitedCells(path, p.width) {
+    if cell[0] == p.start.i && cell[1] == p.start.j {
+      continue
+    }
+    if p.Loops(cell[0], cell[1], seen, n+1) {
+      obstacles = append(obstacles, cell)
+    }
+  }
+  if debug {
+    fmt.Println("Obstacles that trap the guard:")
+    printData(renderPath(data, path, obstacles))
+  }
+  if svg {
+    err := exportSVG(data, path, obstacles)
+    if err != nil {
+      fmt.Println(err)
     }
-    cleanData[xLoc[0]][xLoc[1]] = rune('X')
   }
+  result := len(obstacles)
   fmt.Printf("Task 2: %d\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, svg bool) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -232,7 +269,7 @@ func Run(path string, taskId int, debug bool) error {
   case 1:
     task1(data, debug)
   case 2:
-    task2(data, path, debug)
+    task2(data, debug, svg)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -245,9 +282,10 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  svg := slices.Contains(os.Args[1:], "--svg")
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, svg)
     if err != nil {
       fmt.Println(err)
     }
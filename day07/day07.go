@@ -4,14 +4,23 @@ import (
 	"bufio"
   "errors"
 	"fmt"
+	"math"
 	"os"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
   "adventOfCode2024/util"
 )
 
+type options struct {
+  operators []string
+  workers   int
+}
+
 type equation struct {
   result int
   numbers []int
@@ -31,23 +40,184 @@ func printData(data []*equation) {
   }
 }
 
-func operatorSymbol(o string) string {
-  switch o {
-  case "ADD":
-    return "+"
-  case "MUL":
-    return "*"
-  case "CON":
-    return "||"
-  default:
-    return "UNKNOWN"
+// inverse is a left value that gives the target when combined with the
+// next number, anyLeft means every left value does
+type inverse struct {
+  left    int
+  anyLeft bool
+}
+
+// operator combines the running value with the next number from left to
+// right, Undo lists the running values that could have produced target,
+// which lets the solver work backwards and prune impossible branches early
+type operator interface {
+  Symbol() string
+  Apply(left, right int) (int, bool)
+  Undo(target, right int) []inverse
+}
+
+var operators = map[string]operator{}
+
+func registerOperator(name string, op operator) {
+  operators[name] = op
+}
+
+func init() {
+  registerOperator("add", addOperator{})
+  registerOperator("mul", mulOperator{})
+  registerOperator("concat", concatOperator{})
+  registerOperator("sub", subOperator{})
+  registerOperator("div", divOperator{})
+  registerOperator("pow", powOperator{})
+  registerOperator("xor", xorOperator{})
+}
+
+func lookupOperators(names []string) ([]operator, error) {
+  result := make([]operator, len(names))
+  for i, name := range names {
+    op, ok := operators[name]
+    if !ok {
+      return nil, fmt.Errorf("Unknown operator %s, please use add, mul, concat, sub, div, pow or xor", name)
+    }
+    result[i] = op
+  }
+  return result, nil
+}
+
+type addOperator struct{}
+
+func (addOperator) Symbol() string { return "+" }
+func (addOperator) Apply(left, right int) (int, bool) { return left + right, true }
+func (addOperator) Undo(target, right int) []inverse {
+  return []inverse{{left: target - right}}
+}
+
+type subOperator struct{}
+
+func (subOperator) Symbol() string { return "-" }
+func (subOperator) Apply(left, right int) (int, bool) { return left - right, true }
+func (subOperator) Undo(target, right int) []inverse {
+  return []inverse{{left: target + right}}
+}
+
+type mulOperator struct{}
+
+func (mulOperator) Symbol() string { return "*" }
+func (mulOperator) Apply(left, right int) (int, bool) { return left * right, true }
+func (mulOperator) Undo(target, right int) []inverse {
+  if right == 0 {
+    if target == 0 {
+      return []inverse{{anyLeft: true}}
+    }
+    return nil
+  }
+  if target%right != 0 {
+    return nil
+  }
+  return []inverse{{left: target / right}}
+}
+
+// divOperator only divides when there is no remainder
+type divOperator struct{}
+
+func (divOperator) Symbol() string { return "/" }
+func (divOperator) Apply(left, right int) (int, bool) {
+  if right == 0 || left%right != 0 {
+    return 0, false
+  }
+  return left / right, true
+}
+func (divOperator) Undo(target, right int) []inverse {
+  if right == 0 {
+    return nil
+  }
+  return []inverse{{left: target * right}}
+}
+
+type xorOperator struct{}
+
+func (xorOperator) Symbol() string { return "^" }
+func (xorOperator) Apply(left, right int) (int, bool) { return left ^ right, true }
+func (xorOperator) Undo(target, right int) []inverse {
+  return []inverse{{left: target ^ right}}
+}
+
+func pow10(n int) int {
+  result := 10
+  for n >= 10 {
+    n /= 10
+    result *= 10
+  }
+  return result
+}
+
+// concatOperator joins the digits of both numbers, it only works for
+// numbers that aren't negative
+type concatOperator struct{}
+
+func (concatOperator) Symbol() string { return "||" }
+func (concatOperator) Apply(left, right int) (int, bool) {
+  if left < 0 || right < 0 {
+    return 0, false
+  }
+  return left*pow10(right) + right, true
+}
+func (concatOperator) Undo(target, right int) []inverse {
+  if target < 0 || right < 0 {
+    return nil
+  }
+  shift := pow10(right)
+  if target%shift != right {
+    return nil
   }
+  return []inverse{{left: target / shift}}
 }
 
-func printSolution(eq *equation, operators []string) {
+// powOperator raises the running value to the power of the next number,
+// negative powers aren't allowed
+type powOperator struct{}
+
+func (powOperator) Symbol() string { return "**" }
+func (powOperator) Apply(left, right int) (int, bool) {
+  if right < 0 {
+    return 0, false
+  }
+  result := 1
+  for range right {
+    next := result * left
+    if left != 0 && next/left != result {
+      return 0, false
+    }
+    result = next
+  }
+  return result, true
+}
+func (p powOperator) Undo(target, right int) []inverse {
+  if right < 0 {
+    return nil
+  }
+  if right == 0 {
+    if target == 1 {
+      return []inverse{{anyLeft: true}}
+    }
+    return nil
+  }
+  root := int(math.Round(math.Pow(math.Abs(float64(target)), 1/float64(right))))
+  var result []inverse
+  for _, candidate := range []int{root - 1, root, root + 1, -root + 1, -root, -root - 1} {
+    value, ok := p.Apply(candidate, right)
+    if !ok || value != target || slices.ContainsFunc(result, func(i inverse) bool { return i.left == candidate }) {
+      continue
+    }
+    result = append(result, inverse{left: candidate})
+  }
+  return result
+}
+
+func printSolution(eq *equation, solution []operator) {
   output := fmt.Sprintf("%d = %d", eq.result, eq.numbers[0])
   for i := 1; i < len(eq.numbers); i++ {
-    output += fmt.Sprintf(" %v %v", operatorSymbol(operators[i-1]), eq.numbers[i])
+    output += fmt.Sprintf(" %v %v", solution[i-1].Symbol(), eq.numbers[i])
   }
   fmt.Println(output)
 }
@@ -75,70 +245,111 @@ func readInput(path string) ([]*equation, error) {
   return data, nil
 }
 
-func getResult(numbers []int, operators []string) int {
-  result := numbers[0]
-  for i := 1; i < len(numbers); i++ {
-    switch operators[i-1] {
-    case "ADD":
-      result += numbers[i]
-    case "MUL":
-      result *= numbers[i]
-    case "CON":
-      result, _ = strconv.Atoi(strconv.Itoa(result)+strconv.Itoa(numbers[i]))
-    default:
-      continue
+// anyOperators finds operators that can be applied to all numbers, for
+// when the value they produce doesn't matter
+func anyOperators(numbers []int, ops []operator) ([]operator, bool) {
+  var search func(value, idx int, chosen []operator) ([]operator, bool)
+  search = func(value, idx int, chosen []operator) ([]operator, bool) {
+    if idx == len(numbers) {
+      return chosen, true
+    }
+    for _, op := range ops {
+      next, ok := op.Apply(value, numbers[idx])
+      if !ok {
+        continue
+      }
+      if result, ok := search(next, idx+1, append(chosen, op)); ok {
+        return result, true
+      }
     }
+    return nil, false
   }
-  return result
+  return search(numbers[0], 1, make([]operator, 0, len(numbers)-1))
 }
 
-func getOperatorPermutations(operators []string, l int, current []string, permutations *[][]string) {
-  if len(current) == l {
-    permCopy := make([]string, len(current))
-    copy(permCopy, current)
-    *permutations = append(*permutations, permCopy)
-    return
+// solve works backwards from the target, undoing the last number with every
+// operator, so a branch ends as soon as no operator can produce the target
+func solve(target int, numbers []int, ops []operator) ([]operator, bool) {
+  last := len(numbers) - 1
+  if last == 0 {
+    return []operator{}, numbers[0] == target
   }
-  for _, o := range operators {
-    getOperatorPermutations(operators, l, append(current, o), permutations)
+  for _, op := range ops {
+    for _, inv := range op.Undo(target, numbers[last]) {
+      var prefix []operator
+      var ok bool
+      if inv.anyLeft {
+        prefix, ok = anyOperators(numbers[:last], ops)
+      } else {
+        prefix, ok = solve(inv.left, numbers[:last], ops)
+      }
+      if ok {
+        return append(prefix, op), true
+      }
+    }
   }
+  return nil, false
 }
 
-func getCalibration(data []*equation, operators []string, debug bool) int {
+// getCalibration solves the equations on workers goroutines, every worker
+// takes the next equation that hasn't been solved yet
+func getCalibration(data []*equation, ops []operator, workers int, debug bool) int {
+  solutions := make([][]operator, len(data))
+  next := make(chan int)
+  var wg sync.WaitGroup
+  for range workers {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for i := range next {
+        if solution, ok := solve(data[i].result, data[i].numbers, ops); ok {
+          solutions[i] = solution
+        }
+      }
+    }()
+  }
+  for i := range data {
+    next <- i
+  }
+  close(next)
+  wg.Wait()
   result := 0
   if debug {
     fmt.Println("\nValid equations:")
   }
-  for _, eq := range data {
-    var permutations [][]string
-    getOperatorPermutations(operators, len(eq.numbers)-1, []string{}, &permutations)
-    for _, p := range permutations {
-      tempRes := getResult(eq.numbers, p)
-      if tempRes == eq.result {
-        result += eq.result
-        if debug {
-          printSolution(eq, p)
-        }
-        break
-      }
+  for i, eq := range data {
+    if solutions[i] == nil {
+      continue
+    }
+    result += eq.result
+    if debug {
+      printSolution(eq, solutions[i])
     }
   }
   return result
 }
 
-func task1(data []*equation, debug bool) {
-  operators := []string{"ADD", "MUL"}
-  result := getCalibration(data, operators, debug)
+func task1(data []*equation, debug bool, opts options) error {
+  ops, err := lookupOperators([]string{"add", "mul"})
+  if err != nil {
+    return err
+  }
+  result := getCalibration(data, ops, opts.workers, debug)
   fmt.Printf("Task 1: %d\n", result)
+  return nil
 }
 
-func task2(data []*equation, debug bool) {
-  operators := []string{"ADD", "MUL", "CON"}
-  result := getCalibration(data, operators, debug)
+func task2(data []*equation, debug bool, opts options) error {
+  ops, err := lookupOperators(opts.operators)
+  if err != nil {
+    return err
+  }
+  result := getCalibration(data, ops, opts.workers, debug)
   fmt.Printf("Task 2: %d\n", result)
+  return nil
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -150,13 +361,13 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    err = task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    err = task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
-  return nil
+  return err
 }
 
 func main() {
@@ -165,9 +376,21 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  opts := options{operators: []string{"add", "mul", "concat"}}
+  if value, ok := util.ArgValue(os.Args[1:], "--operators"); ok {
+    opts.operators = strings.Split(value, ",")
+  }
+  opts.workers, err = util.IntArg(os.Args[1:], "--workers", runtime.NumCPU())
+  if err == nil && opts.workers < 1 {
+    err = errors.New("Number of workers has to be at least 1")
+  }
+  if err != nil {
+    fmt.Printf("%v\nExiting!\n", err)
+    os.Exit(1)
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -18,30 +18,17 @@ type point struct {
   y int
 }
 
-func newPoint(x, y int) *point {
-  return &point{x: x, y: y}
-}
-
-func (p *point) String() string {
+func (p point) String() string {
   return fmt.Sprintf("(%d, %d)", p.x, p.y)
 }
 
-func containsPoint(s []*point, p *point) bool {
-  for _, ps := range s {
-    if ps.x == p.x && ps.y == p.y {
-      return true
-    }
-  }
-  return false
-}
-
 func printData(d [][]rune) {
   for _, s := range d {
     fmt.Println(string(s))
   }
 }
 
-func printAntennas(a map[rune][]*point) {
+func printAntennas(a map[rune][]point) {
   for k, v := range a {
     fmt.Printf("%v: %v\n", string(k), v)
   }
@@ -62,111 +49,135 @@ func readInput(path string) ([][]rune, error) {
   return data, nil
 }
 
-func getAntennas(data [][]rune) map[rune][]*point {
-  antennas := make(map[rune][]*point)
+func getAntennas(data [][]rune) map[rune][]point {
+  antennas := make(map[rune][]point)
   for i, line := range data {
     for j, sym := range line {
       if !unicode.IsUpper(sym) && !unicode.IsLower(sym) && !unicode.IsDigit(sym) {
         continue
       }
-      _, ok := antennas[sym]
-      if !ok {
-        antennas[sym] = []*point{}
-      }
-      antennas[sym] = append(antennas[sym], newPoint(i, j))
+      antennas[sym] = append(antennas[sym], point{x: i, y: j})
     }
   }
-  antennas[rune('#')] = []*point{}
   return antennas
 }
 
-func getNewPoints(p *point, dx, dy, cnt, rowLen, colLen int) []*point {
-  // newPoint(p1.x - dx, p1.y + dy), newPoint(p2.x + dx, p2.y - dy)
-  var newPoints []*point
-  np := newPoint(p.x, p.y)
-  for range cnt {
-    np = newPoint(np.x - dx, np.y + dy)
-    if np.x < 0 || np.x >= rowLen || np.y < 0 || np.y >= colLen {
-      break
-    }
-    newPoints = append(newPoints, np)
+func gcd(a, b int) int {
+  a, b = max(a, -a), max(b, -b)
+  for b != 0 {
+    a, b = b, a%b
   }
-  return newPoints
+  return a
 }
 
-func getAntinodes(p1, p2 *point, cnt, rowLen, colLen int) []*point {
-  dx := p2.x - p1.x
-  dy := p1.y - p2.y
-  newPoints1 := getNewPoints(p1, dx, dy, cnt, rowLen, colLen)
-  newPoints2 := getNewPoints(p2, dx*-1, dy*-1, cnt, rowLen, colLen)
-  return slices.Concat(newPoints1, newPoints2)
+// antinodeMap keeps the antinodes of every frequency apart from the input,
+// the same point can be an antinode of several frequencies
+type antinodeMap struct {
+  height      int
+  width       int
+  byFrequency map[rune]map[point]bool
+  all         map[point]bool
 }
 
-func task1(data [][]rune, debug bool) {
-  antennas := getAntennas(data)
-  rowLen := len(data[0])
-  colLen := len(data)
-  for sym, pts := range antennas {
-    if sym == rune('#') {
-      continue
-    }
-    for i := 0; i < len(pts); i++ {
-      for j := i+1; j <len(pts); j++ {
-        antinodes := getAntinodes(pts[i], pts[j], 1, rowLen, colLen)
-        for _, a := range antinodes {
-          if containsPoint(antennas[rune('#')], a) {
-            continue
-          }
-          antennas[rune('#')] = append(antennas[rune('#')], a)
-          data[a.x][a.y] = rune('#')
-        }
-      }
-    }
+func newAntinodeMap(data [][]rune) *antinodeMap {
+  return &antinodeMap{
+    height: len(data),
+    width: len(data[0]),
+    byFrequency: make(map[rune]map[point]bool),
+    all: make(map[point]bool),
   }
-  if debug {
-    printAntennas(antennas)
-    printData(data)
+}
+
+func (a *antinodeMap) inside(p point) bool {
+  return p.x >= 0 && p.x < a.height && p.y >= 0 && p.y < a.width
+}
+
+func (a *antinodeMap) add(frequency rune, p point) {
+  if !a.inside(p) {
+    return
   }
-  result := len(antennas[rune('#')])
-  fmt.Printf("Task 1: %d\n", result)
+  if a.byFrequency[frequency] == nil {
+    a.byFrequency[frequency] = make(map[point]bool)
+  }
+  a.byFrequency[frequency][p] = true
+  a.all[p] = true
 }
 
-func task2(data [][]rune, debug bool) {
-  antennas := getAntennas(data)
-  rowLen := len(data[0])
-  colLen := len(data)
-  for  sym := range maps.Keys(antennas) {
-    if sym == rune('#') {
-      continue
-    }
-    antennas[rune('#')] = slices.Concat(antennas[rune('#')], antennas[sym])
+// addPair adds the two antinodes twice as far from one antenna as from the
+// other, with harmonics every grid point on the line through both antennas
+// is an antinode, so the step between them is reduced by the gcd
+func (a *antinodeMap) addPair(frequency rune, p1, p2 point, harmonics bool) {
+  dx, dy := p2.x-p1.x, p2.y-p1.y
+  if !harmonics {
+    a.add(frequency, point{x: p1.x - dx, y: p1.y - dy})
+    a.add(frequency, point{x: p2.x + dx, y: p2.y + dy})
+    return
   }
-  for sym, pts := range antennas {
-    if sym == rune('#') {
-      continue
-    }
+  g := gcd(dx, dy)
+  dx, dy = dx/g, dy/g
+  for p := p1; a.inside(p); p = (point{x: p.x - dx, y: p.y - dy}) {
+    a.add(frequency, p)
+  }
+  for p := p1; a.inside(p); p = (point{x: p.x + dx, y: p.y + dy}) {
+    a.add(frequency, p)
+  }
+}
+
+func findAntinodes(data [][]rune, harmonics bool) *antinodeMap {
+  a := newAntinodeMap(data)
+  for sym, pts := range getAntennas(data) {
     for i := 0; i < len(pts); i++ {
-      for j := i+1; j <len(pts); j++ {
-        antinodes := getAntinodes(pts[i], pts[j], max(rowLen, colLen), rowLen, colLen)
-        for _, a := range antinodes {
-          if containsPoint(antennas[rune('#')], a) {
-            continue
-          }
-          antennas[rune('#')] = append(antennas[rune('#')], a)
-          data[a.x][a.y] = rune('#')
-        }
+      for j := i+1; j < len(pts); j++ {
+        a.addPair(sym, pts[i], pts[j], harmonics)
       }
     }
   }
+  return a
+}
+
+func (a *antinodeMap) Render(data [][]rune) [][]rune {
+  result := make([][]rune, len(data))
+  for i := range data {
+    result[i] = slices.Clone(data[i])
+  }
+  for p := range a.all {
+    if result[p.x][p.y] == rune('.') {
+      result[p.x][p.y] = rune('#')
+    }
+  }
+  return result
+}
+
+func (a *antinodeMap) printFrequencies() {
+  frequencies := slices.Sorted(maps.Keys(a.byFrequency))
+  for _, sym := range frequencies {
+    fmt.Printf("Frequency %s: %d antinodes\n", string(sym), len(a.byFrequency[sym]))
+  }
+}
+
+func countAntinodes(data [][]rune, harmonics bool, debug bool, frequencies bool) int {
+  a := findAntinodes(data, harmonics)
   if debug {
-    printAntennas(antennas)
-    printData(data)
+    printAntennas(getAntennas(data))
+    printData(a.Render(data))
+  }
+  if frequencies {
+    a.printFrequencies()
   }
-  result := len(antennas[rune('#')])
+  return len(a.all)
+}
+
+func task1(data [][]rune, debug bool, frequencies bool) {
+  result := countAntinodes(data, false, debug, frequencies)
+  fmt.Printf("Task 1: %d\n", result)
+}
+
+func task2(data [][]rune, debug bool, frequencies bool) {
+  result := countAntinodes(data, true, debug, frequencies)
   fmt.Printf("Task 2: %d\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, frequencies bool) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -178,9 +189,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, frequencies)
   case 2:
-    task2(data, debug)
+    task2(data, debug, frequencies)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -193,9 +204,10 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  frequencies := slices.Contains(os.Args[1:], "--frequencies")
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, frequencies)
     if err != nil {
       fmt.Println(err)
     }
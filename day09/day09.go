@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"container/heap"
 	"errors"
 	"fmt"
 	"os"
@@ -13,12 +14,18 @@ import (
 	"adventOfCode2024/util"
 )
 
-func printData(d []string) {
-  fmt.Println(strings.Join(d, ""))
+// Layouts longer than this are not rendered block by block
+const renderLimit = 200
+
+func printData(d []int) {
+  for _, di := range d {
+    fmt.Print(di)
+  }
+  fmt.Println()
 }
 
-func readInput(path string) ([]string, error) {
-  var data []string
+func readInput(path string) ([]int, error) {
+  var data []int
   file, err := os.Open(path)
   defer file.Close()
   if err != nil {
@@ -26,164 +33,351 @@ func readInput(path string) ([]string, error) {
   }
   scanner := bufio.NewScanner(file)
   for scanner.Scan() {
-    line := scanner.Text()
-    data = slices.Concat(data, strings.Split(line, ""))
+    for i, r := range strings.TrimSpace(scanner.Text()) {
+      if r < rune('0') || r > rune('9') {
+        return data, fmt.Errorf("Invalid disk map digit %q at position %d", r, i)
+      }
+      data = append(data, int(r-rune('0')))
+    }
   }
   return data, nil
 }
 
-func transformData(data []string) []string {
-  var td []string
-  currId := 0
-  for i, dS := range data {
-    dI, _ := strconv.Atoi(dS)
+// segment is a run of blocks that belong to one file, a file compacted
+// block by block can end up in several segments
+type segment struct {
+  id     int
+  offset int
+  length int
+}
+
+type span struct {
+  offset int
+  length int
+}
+
+// spanHeap keeps free spans of one length with the leftmost on top
+type spanHeap []span
+
+func (h spanHeap) Len() int { return len(h) }
+func (h spanHeap) Less(i, j int) bool { return h[i].offset < h[j].offset }
+func (h spanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *spanHeap) Push(x any) { *h = append(*h, x.(span)) }
+func (h *spanHeap) Pop() any {
+  old := *h
+  x := old[len(old)-1]
+  *h = old[:len(old)-1]
+  return x
+}
+
+// disk holds the files as segments and the free spans in one heap per
+// length, free is indexed by the length of the spans it holds
+type disk struct {
+  segments    []*segment
+  free        []*spanHeap
+  size        int
+  cursor      int
+  moves       int
+  blocksMoved int
+}
+
+type options struct {
+  policy string
+  stats  bool
+}
+
+func newDisk(data []int) *disk {
+  d := &disk{free: make([]*spanHeap, 10)}
+  for i := range d.free {
+    d.free[i] = &spanHeap{}
+  }
+  for i, length := range data {
     if i%2 == 0 {
-      s := slices.Repeat([]string{strconv.Itoa(currId)}, dI)
-      td = slices.Concat(td, s)
-      currId += 1
-    } else {
-      s := slices.Repeat([]string{"."}, dI)
-      td = slices.Concat(td, s)
+      d.segments = append(d.segments, &segment{id: i/2, offset: d.size, length: length})
+    } else if length > 0 {
+      heap.Push(d.free[length], span{offset: d.size, length: length})
     }
+    d.size += length
   }
-  return td
+  return d
 }
 
-func lastDigit(data []string) int {
-  for i := len(data)-1; i >= 0; i-- {
-    if strings.ContainsAny(data[i], "0123456789") {
-      return i
-    }
+func (d *disk) takeSpan(length, idx int) span {
+  return heap.Remove(d.free[length], idx).(span)
+}
+
+// returnSpan gives back what is left of a span after n blocks were used
+func (d *disk) returnSpan(s span, n int) {
+  if s.length > n {
+    heap.Push(d.free[s.length-n], span{offset: s.offset + n, length: s.length - n})
   }
-  return -1
 }
 
-func digitBlock(data []string, digit int) (int, int) {
-  var ind, size int
-  digitS := strconv.Itoa(digit)
-  for i := len(data)-1; i >= 0; i-- {
-    if data[i] == digitS {
-      size = 0
-      for j := i; j >= 0; j-- {
-        if data[j] != digitS {
-          break
-        }
-        ind = j
-        size += 1
-      }
+// placementPolicy picks the free span a file of minLength blocks is moved
+// to, only spans starting before limit are used, it returns the length of
+// the span and its index in the heap for that length or -1, -1
+type placementPolicy func(d *disk, minLength, limit int) (int, int)
+
+var policies = map[string]placementPolicy{
+  "first-fit": (*disk).leftmostSpan,
+  "best-fit": (*disk).bestSpan,
+  "worst-fit": (*disk).worstSpan,
+  "next-fit": (*disk).nextSpan,
+}
+
+func (d *disk) fits(length, limit int) bool {
+  h := *d.free[length]
+  return len(h) > 0 && h[0].offset < limit
+}
 
-      return ind, size
+// leftmostSpan finds the leftmost free span that is at least minLength
+// long and starts before limit
+func (d *disk) leftmostSpan(minLength, limit int) (int, int) {
+  result := -1
+  for length := minLength; length < len(d.free); length++ {
+    if !d.fits(length, limit) {
+      continue
+    }
+    if result == -1 || (*d.free[length])[0].offset < (*d.free[result])[0].offset {
+      result = length
     }
   }
-  return -1, -1
+  if result == -1 {
+    return -1, -1
+  }
+  return result, 0
 }
 
-func firstSpace(data []string) int {
-  for i := 0; i < len(data); i++ {
-    if data[i] == "." {
-      return i
+func (d *disk) bestSpan(minLength, limit int) (int, int) {
+  for length := minLength; length < len(d.free); length++ {
+    if d.fits(length, limit) {
+      return length, 0
     }
   }
-  return -1
+  return -1, -1
 }
 
-func findSpaceBlock(data []string, size int) int {
-  for i := 0; i < len(data); {
-    if data[i] != "." {
-      i++
-      continue
+func (d *disk) worstSpan(minLength, limit int) (int, int) {
+  for length := len(d.free) - 1; length >= minLength; length-- {
+    if d.fits(length, limit) {
+      return length, 0
     }
-    iSize := 0
-    for _, d := range data[i:] {
-      if d != "." {
-        break
+  }
+  return -1, -1
+}
+
+// nextSpan carries on from where the last file was placed and only starts
+// again from the beginning of the disk when nothing after it fits, the
+// heaps only know their leftmost span so every span has to be looked at
+func (d *disk) nextSpan(minLength, limit int) (int, int) {
+  bestLength, bestIdx := -1, -1
+  bestOffset, bestWrapped := 0, true
+  for length := minLength; length < len(d.free); length++ {
+    for idx, s := range *d.free[length] {
+      if s.offset >= limit {
+        continue
+      }
+      wrapped := s.offset < d.cursor
+      if bestLength == -1 || (!wrapped && bestWrapped) || (wrapped == bestWrapped && s.offset < bestOffset) {
+        bestLength, bestIdx, bestOffset, bestWrapped = length, idx, s.offset, wrapped
       }
-      iSize++
     }
-    if iSize < size {
-      i += iSize
+  }
+  return bestLength, bestIdx
+}
+
+// compactBlocks moves single blocks from the end of the disk to the
+// leftmost free block until there are no gaps between the files
+func (d *disk) compactBlocks() {
+  var moved []*segment
+  last := len(d.segments) - 1
+  for last >= 0 {
+    tail := d.segments[last]
+    if tail.length == 0 {
+      last--
       continue
     }
-    return i
+    length, idx := d.leftmostSpan(1, tail.offset)
+    if length == -1 {
+      break
+    }
+    s := d.takeSpan(length, idx)
+    n := min(s.length, tail.length)
+    moved = append(moved, &segment{id: tail.id, offset: s.offset, length: n})
+    tail.length -= n
+    d.moves++
+    d.blocksMoved += n
+    d.returnSpan(s, n)
   }
-  return -1
+  d.segments = slices.Concat(d.segments, moved)
+  d.sortSegments()
 }
 
-func checksum(data []string) int {
-  chksm := 0
-  for i, dS := range data {
-    if dS == "0" || dS == "." {
+// compactFiles moves every file once, starting with the highest id, to the
+// free span before it that the policy picks
+func (d *disk) compactFiles(policy placementPolicy) {
+  for i := len(d.segments) - 1; i >= 0; i-- {
+    file := d.segments[i]
+    if file.length == 0 {
+      continue
+    }
+    length, idx := policy(d, file.length, file.offset)
+    if length == -1 {
       continue
     }
-    dI, _ := strconv.Atoi(dS)
-    chksm += i*dI
+    s := d.takeSpan(length, idx)
+    file.offset = s.offset
+    d.cursor = s.offset + file.length
+    d.returnSpan(s, file.length)
+    d.moves++
+    d.blocksMoved += file.length
   }
-  return chksm
+  d.sortSegments()
 }
 
-func task1(data []string, debug bool) {
-  result := 0
-  data = transformData(data)
-  if debug {
-    fmt.Println("Transformed data:")
-    printData(data)
-    fmt.Println("-----------------")
+// defragment slides every file to the left until there are no gaps left,
+// the files keep their order so each is moved at most once
+func (d *disk) defragment() {
+  d.sortSegments()
+  position := 0
+  for _, s := range d.segments {
+    if s.offset != position {
+      s.offset = position
+      d.moves++
+      d.blocksMoved += s.length
+    }
+    position += s.length
+  }
+  for i := range d.free {
+    d.free[i] = &spanHeap{}
   }
-  for {
-    lastDigitIndex := lastDigit(data)
-    firstSpaceIndex := firstSpace(data)
-    if debug {
-      printData(data)
+}
+
+func (d *disk) Compact(mode string) error {
+  switch mode {
+  case "blocks":
+    d.compactBlocks()
+  case "full":
+    d.defragment()
+  default:
+    policy, ok := policies[mode]
+    if !ok {
+      return fmt.Errorf("Unknown policy %s, please use first-fit, best-fit, worst-fit, next-fit or full", mode)
     }
-    if lastDigitIndex < firstSpaceIndex {
-      break
+    d.compactFiles(policy)
+  }
+  return nil
+}
+
+// freeSpans lists the lengths of the gaps in the layout, including the
+// free space at the end of the disk
+func (d *disk) freeSpans() []int {
+  var result []int
+  position := 0
+  for _, s := range d.segments {
+    if s.offset > position {
+      result = append(result, s.offset-position)
     }
-    data[firstSpaceIndex] = data[lastDigitIndex]
-    data[lastDigitIndex] = "."
+    position = s.offset + s.length
   }
-  result = checksum(data)
-  fmt.Printf("Task 1: %d\n", result)
+  if d.size > position {
+    result = append(result, d.size-position)
+  }
+  return result
+}
+
+func (d *disk) printStats(mode string) {
+  spans := d.freeSpans()
+  largest := 0
+  if len(spans) > 0 {
+    largest = slices.Max(spans)
+  }
+  fmt.Printf("%-10s moves: %6d, blocks moved: %7d, free spans: %5d, largest free span: %6d, checksum: %d\n", mode, d.moves, d.blocksMoved, len(spans), largest, d.Checksum())
 }
 
-func task2(data []string, debug bool) {
+func (d *disk) sortSegments() {
+  d.segments = slices.DeleteFunc(d.segments, func(s *segment) bool {
+    return s.length == 0
+  })
+  slices.SortFunc(d.segments, func(s1, s2 *segment) int {
+    return s1.offset - s2.offset
+  })
+}
+
+func (d *disk) Checksum() int {
   result := 0
-  data = transformData(data)
+  for _, s := range d.segments {
+    // Sum of the block positions offset..offset+length-1
+    result += s.id * (s.length*s.offset + s.length*(s.length-1)/2)
+  }
+  return result
+}
+
+// Render writes the layout in the 00...111...2 notation of the puzzle
+func (d *disk) Render() string {
+  var sb strings.Builder
+  position := 0
+  for _, s := range d.segments {
+    sb.WriteString(strings.Repeat(".", s.offset-position))
+    sb.WriteString(strings.Repeat(strconv.Itoa(s.id), s.length))
+    position = s.offset + s.length
+  }
+  sb.WriteString(strings.Repeat(".", d.size-position))
+  return sb.String()
+}
+
+func (d *disk) printLayout(title string) {
+  if d.size > renderLimit {
+    fmt.Printf("%s: %d blocks, too many to render\n", title, d.size)
+    return
+  }
+  fmt.Printf("%s:\n%s\n", title, d.Render())
+}
+
+func compactDisk(data []int, mode string, debug bool, stats bool) (int, error) {
+  d := newDisk(data)
   if debug {
-    fmt.Println("Transformed data:")
-    printData(data)
-    fmt.Println("-----------------")
+    d.printLayout("Disk layout")
+  }
+  err := d.Compact(mode)
+  if err != nil {
+    return 0, err
   }
-  currIdS := data[lastDigit(data)]
-  currId, _ := strconv.Atoi(currIdS)
   if debug {
-    fmt.Printf("Highest index is %d\n", currId)
+    d.printLayout(fmt.Sprintf("Disk layout after compacting with %s", mode))
   }
-  for currId > 0 {
-    digitIndex, digitBlockSize := digitBlock(data, currId)
-    if debug {
-      printData(data)
-      fmt.Printf("Looking for space block of size %d for digit %d\n", digitBlockSize, currId)
-    }
-    spaceBlockIndex := findSpaceBlock(data, digitBlockSize)
-    if spaceBlockIndex == -1 {
-      currId--
-      continue
-    }
-    if digitIndex < spaceBlockIndex {
-      currId--
-      continue
-    }
-    for i := range digitBlockSize {
-      data[spaceBlockIndex+i] = data[digitIndex+i]
-      data[digitIndex+i] = "."
+  if stats {
+    d.printStats(mode)
+  }
+  return d.Checksum(), nil
+}
+
+func task1(data []int, debug bool, opts options) error {
+  result, err := compactDisk(data, "blocks", debug, opts.stats)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Task 1: %d\n", result)
+  return nil
+}
+
+func task2(data []int, debug bool, opts options) error {
+  if opts.stats {
+    for _, mode := range []string{"first-fit", "best-fit", "worst-fit", "next-fit", "full"} {
+      if mode != opts.policy {
+        compactDisk(data, mode, false, true)
+      }
     }
-    currId--
   }
-  result = checksum(data)
+  result, err := compactDisk(data, opts.policy, debug, opts.stats)
+  if err != nil {
+    return err
+  }
   fmt.Printf("Task 2: %d\n", result)
+  return nil
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -195,13 +389,13 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    err = task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    err = task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
-  return nil
+  return err
 }
 
 func main() {
@@ -210,9 +404,13 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  opts := options{policy: "first-fit", stats: slices.Contains(os.Args[1:], "--stats")}
+  if value, ok := util.ArgValue(os.Args[1:], "--policy"); ok {
+    opts.policy = value
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
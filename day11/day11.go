@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"slices"
 	"strconv"
@@ -13,15 +14,21 @@ import (
 	"adventOfCode2024/util"
 )
 
-func printData(d []string) {
+type options struct {
+  blinks   int
+  modulus  int64
+  distinct bool
+}
+
+func printData(d []int) {
   for _, s := range d {
-    fmt.Printf("%s ", s)
+    fmt.Printf("%d ", s)
   }
   fmt.Println()
 }
 
-func readInput(path string) ([]string, error) {
-  var data []string
+func readInput(path string) ([]int, error) {
+  var data []int
   file, err := os.Open(path)
   defer file.Close()
   if err != nil {
@@ -29,79 +36,131 @@ func readInput(path string) ([]string, error) {
   }
   scanner := bufio.NewScanner(file)
   for scanner.Scan() {
-    line := scanner.Text()
-    splitLine := strings.Split(line, " ")
-    data = slices.Concat(data, splitLine)
+    for _, field := range strings.Fields(scanner.Text()) {
+      stone, err := strconv.Atoi(field)
+      if err != nil {
+        return data, fmt.Errorf("Invalid stone: %s", field)
+      }
+      data = append(data, stone)
+    }
   }
   return data, nil
 }
 
-func trimNumber(number string) string {
-  for i, n := range number {
-    if n != rune('0') {
-      return strings.Join(strings.Split(number, "")[i:], "")
-    }
+// splitStone splits a stone with an even number of digits into its left
+// and right halves, leading zeros vanish on their own
+func splitStone(stone int) (int, int, bool) {
+  digits := 1
+  for power := 10; power <= stone; power *= 10 {
+    digits++
+  }
+  if digits%2 != 0 {
+    return 0, 0, false
   }
-  return "0"
+  half := 1
+  for range digits / 2 {
+    half *= 10
+  }
+  return stone / half, stone % half, true
+}
+
+// stoneCounter only keeps how many stones carry every value, the order of
+// the stones never matters for the count
+type stoneCounter struct {
+  counts   map[int]*big.Int
+  modulus  *big.Int
+  blinks   int
+  distinct []int
 }
 
-func blink(digit string, blinksLeft int, memo map[string][]int, totalBlinks int) int{
-  if blinksLeft == -1 {
-    return 1
+func newStoneCounter(stones []int, modulus int64) *stoneCounter {
+  s := &stoneCounter{counts: make(map[int]*big.Int)}
+  if modulus > 0 {
+    s.modulus = big.NewInt(modulus)
+  }
+  for _, stone := range stones {
+    s.add(s.counts, stone, big.NewInt(1))
   }
-  _, ok := memo[digit]
+  s.distinct = append(s.distinct, len(s.counts))
+  return s
+}
+
+func (s *stoneCounter) add(counts map[int]*big.Int, stone int, count *big.Int) {
+  current, ok := counts[stone]
   if !ok {
-    memo[digit] = make([]int, totalBlinks)
-  }
-  if memo[digit][blinksLeft] != 0 {
-    return memo[digit][blinksLeft]
-  }
-  result := 0
-  if digit == "0" {
-    result += blink("1", blinksLeft-1, memo, totalBlinks)
-  } else if len(digit) % 2 == 0 {
-    splitDigit := strings.Split(digit, "")
-    d1 := trimNumber(strings.Join(splitDigit[:len(digit)/2], ""))
-    result += blink(d1, blinksLeft-1, memo, totalBlinks)
-    d2 := trimNumber(strings.Join(splitDigit[len(digit)/2:], ""))
-    result += blink(d2, blinksLeft-1, memo, totalBlinks)
-  } else {
-  dI, _ := strconv.Atoi(digit)
-  result += blink(strconv.Itoa(dI * 2024), blinksLeft-1, memo, totalBlinks)
-  }
-  memo[digit][blinksLeft] = result
-  return result
+    current = new(big.Int)
+    counts[stone] = current
+  }
+  current.Add(current, count)
+  if s.modulus != nil {
+    current.Mod(current, s.modulus)
+  }
 }
 
-func task1(data []string, debug bool) {
-  result := 0
-  nBlinks := 25
-  memo := make(map[string][]int)
-  for _, d := range data {
-    dResult := blink(d, nBlinks-1, memo, nBlinks)
-    result += dResult
-    if debug {
-      fmt.Printf("Stone %s produces %d stones in %d blinks\n", d, dResult, nBlinks)
+func (s *stoneCounter) Blink() {
+  next := make(map[int]*big.Int, len(s.counts))
+  for stone, count := range s.counts {
+    if stone == 0 {
+      s.add(next, 1, count)
+    } else if left, right, ok := splitStone(stone); ok {
+      s.add(next, left, count)
+      s.add(next, right, count)
+    } else {
+      s.add(next, stone*2024, count)
     }
   }
-  fmt.Printf("Task 1: %d\n", result)
+  s.counts = next
+  s.blinks++
+  s.distinct = append(s.distinct, len(s.counts))
 }
 
-func task2(data []string, debug bool) {
-  result := 0
-  nBlinks := 75
-  memo := make(map[string][]int)
-  for _, d := range data {
-    dResult := blink(d, nBlinks-1, memo, nBlinks)
-    result += dResult
-    if debug {
-      fmt.Printf("Stone %s produces %d stones in %d blinks\n", d, dResult, nBlinks)
+func (s *stoneCounter) Total() *big.Int {
+  result := new(big.Int)
+  for _, count := range s.counts {
+    result.Add(result, count)
+  }
+  if s.modulus != nil {
+    result.Mod(result, s.modulus)
+  }
+  return result
+}
+
+func countStones(data []int, nBlinks int, debug bool, opts options) string {
+  if debug {
+    for _, d := range data {
+      s := newStoneCounter([]int{d}, opts.modulus)
+      for range nBlinks {
+        s.Blink()
+      }
+      fmt.Printf("Stone %d produces %s stones in %d blinks\n", d, s.Total(), nBlinks)
+    }
+  }
+  s := newStoneCounter(data, opts.modulus)
+  for range nBlinks {
+    s.Blink()
+  }
+  if opts.distinct {
+    for blink, distinct := range s.distinct {
+      fmt.Printf("Blink %d: %d distinct stones\n", blink, distinct)
     }
   }
-  fmt.Printf("Task 2: %d\n", result)
+  if s.modulus != nil {
+    return fmt.Sprintf("%s (mod %s)", s.Total(), s.modulus)
+  }
+  return s.Total().String()
+}
+
+func task1(data []int, debug bool, opts options) {
+  result := countStones(data, 25, debug, opts)
+  fmt.Printf("Task 1: %s\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func task2(data []int, debug bool, opts options) {
+  result := countStones(data, opts.blinks, debug, opts)
+  fmt.Printf("Task 2: %s\n", result)
+}
+
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -113,9 +172,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -128,9 +187,26 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  opts := options{distinct: slices.Contains(os.Args[1:], "--distinct")}
+  opts.blinks, err = util.IntArg(os.Args[1:], "--blinks", 75)
+  if err == nil {
+    var modulus int
+    modulus, err = util.IntArg(os.Args[1:], "--modulus", 0)
+    opts.modulus = int64(modulus)
+  }
+  if err == nil && opts.blinks < 0 {
+    err = errors.New("Number of blinks can't be negative")
+  }
+  if _, ok := util.ArgValue(os.Args[1:], "--modulus"); err == nil && ok && opts.modulus < 1 {
+    err = errors.New("Modulus has to be a positive number")
+  }
+  if err != nil {
+    fmt.Printf("%v\nExiting!\n", err)
+    os.Exit(1)
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -2,192 +2,143 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-  "slices"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"adventOfCode2024/util"
 )
 
-type neibghours struct {
-  left *gardenPlot
-  right *gardenPlot
-  up *gardenPlot
-  down *gardenPlot
-}
-
-func newNeibghours() *neibghours {
-  return &neibghours{left: nil, right: nil, up: nil, down: nil}
-}
-
 type gardenPlot struct {
   x int
   y int
   symbol string
-  neibghours *neibghours
-}
-
-type region struct {
-  area int
-  perimiter int
-  sides int
-  symbol string
-  gardenPlots []*gardenPlot
 }
 
 func newGardenPlot(x, y int, symbol string) *gardenPlot {
-  return &gardenPlot{x: x, y: y, symbol: symbol, neibghours: newNeibghours()}
+  return &gardenPlot{x: x, y: y, symbol: symbol}
 }
 
 func (gp *gardenPlot) String() string {
   return fmt.Sprintf("%s(%d, %d)", gp.symbol, gp.x, gp.y)
 }
 
-func (gp1 *gardenPlot) addNeibghour(gp2 *gardenPlot) {
-  dx := gp1.x - gp2.x
-  dy := gp1.y - gp2.y
-  if dy == 0 {
-    if dx == -1 {
-      gp1.neibghours.up = gp2
-      return
-    }
-    if dx == 1 {
-      gp1.neibghours.down = gp2
-      return
-    }
-    return
-  }
-  if dx == 0 {
-    if dy == -1 {
-      gp1.neibghours.left = gp2
-      return
-    }
-    if dy == 1 {
-      gp1.neibghours.right = gp2
-      return
-    }
-    return
-  }
+type region struct {
+  id int
+  area int
+  perimiter int
+  sides int
+  symbol string
+  minX int
+  minY int
+  maxX int
+  maxY int
+  gardenPlots []*gardenPlot
+  enclosedBy int
+  holes int
+  boundaries []*boundary
 }
 
-func newRegion(gardenPlots []*gardenPlot) *region {
-  return &region{area: -1, perimiter: -1, sides: -1, gardenPlots: gardenPlots, symbol: gardenPlots[0].symbol}
+func newRegion(id int, gp *gardenPlot) *region {
+  return &region{id: id, symbol: gp.symbol, minX: gp.x, minY: gp.y, maxX: gp.x, maxY: gp.y, enclosedBy: -1}
 }
 
 func (r *region) String() string {
-  return fmt.Sprintf("Plots: %v\nArea: %d\nPerimiter: %d\nSides: %d\n", r.gardenPlots, r.area, r.perimiter, r.sides)
+  return fmt.Sprintf("Region %d (%s)\nPlots: %v\nArea: %d\nPerimiter: %d\nSides: %d\nBounding box: (%d, %d) - (%d, %d)\n",
+    r.id, r.symbol, r.gardenPlots, r.area, r.perimiter, r.sides, r.minX, r.minY, r.maxX, r.maxY)
 }
 
 func (r *region) appendGardenPlot(gp *gardenPlot) {
-  if ! containsPlot(r.gardenPlots, gp) {
-    r.gardenPlots = append(r.gardenPlots, gp)
-  }
+  r.gardenPlots = append(r.gardenPlots, gp)
+  r.area++
+  r.minX = min(r.minX, gp.x)
+  r.minY = min(r.minY, gp.y)
+  r.maxX = max(r.maxX, gp.x)
+  r.maxY = max(r.maxY, gp.y)
 }
 
-func areNeibghours(gp1, gp2 *gardenPlot) bool {
-  dx := gp1.x - gp2.x
-  dy := gp1.y - gp2.y
-  if (dx == 1 || dx == -1) && dy == 0{
-    return true
-  }
-  if (dy == 1 || dy == -1) && dx == 0{
-    return true
-  }
-  return false
-}
-
-func (r *region) calculateArea() {
-  r.area = len(r.gardenPlots)
+// garden keeps the region id of every plot next to the regions themselves
+type garden struct {
+  plots [][]*gardenPlot
+  labels [][]int
+  regions []*region
 }
 
-func (r *region) calculatePerimiter() {
-  r.sortPlots()
-  r.findNeibghours()
-  r.perimiter = 0
-  for _, gp1 := range r.gardenPlots {
-    r.perimiter += 4
-    if gp1.neibghours.up != nil {
-      r.perimiter--
-    }
-    if gp1.neibghours.down != nil {
-      r.perimiter--
-    }
-    if gp1.neibghours.left != nil {
-      r.perimiter--
-    }
-    if gp1.neibghours.right != nil {
-      r.perimiter--
-    }
+func (g *garden) sameRegion(x, y, label int) bool {
+  if x < 0 || y < 0 || x >= len(g.labels) || y >= len(g.labels[x]) {
+    return false
   }
+  return g.labels[x][y] == label
 }
 
-func (r *region) findNeibghours() {
-  for i := range r.gardenPlots {
-    for j := range r.gardenPlots {
-      r.gardenPlots[i].addNeibghour(r.gardenPlots[j])
+// labelRegions floods every region with a BFS and then measures all of them
+// in one pass over the plots, every side of a region starts at a corner so
+// sides are counted as corners
+func labelRegions(data [][]*gardenPlot) *garden {
+  g := &garden{plots: data, labels: make([][]int, len(data))}
+  for i := range data {
+    g.labels[i] = make([]int, len(data[i]))
+    for j := range g.labels[i] {
+      g.labels[i][j] = -1
     }
   }
-}
-
-func (r *region) sortPlots() {
-  slices.SortFunc(r.gardenPlots, func(gp1, gp2 *gardenPlot) int {
-    if gp1.x == gp2.x {
-      if gp1.y == gp2.y {
-        return 0
-      }
-      if gp1.y > gp2.y {
-        return 1
-      }
-      return -1
-    }
-    if gp1.x > gp2.x {
-      return 1
-    }
-    return -1
-  })
-}
-
-func (r *region) calculateSides() {
-  r.sortPlots()
-  r.findNeibghours()
-  r.sides = 0
-  for _, gp := range r.gardenPlots {
-    // Check up
-    if gp.neibghours.up == nil {
-      if gp.neibghours.left == nil {
-        r.sides++
-      } else if gp.neibghours.left.neibghours.up != nil {
-        r.sides++
+  directions := [][]int{{1,0}, {-1,0}, {0,1}, {0,-1}}
+  for i := range data {
+    for j := range data[i] {
+      if g.labels[i][j] != -1 {
+        continue
       }
-    }
-    // Check down
-    if gp.neibghours.down == nil {
-      if gp.neibghours.left == nil {
-        r.sides++
-      } else if gp.neibghours.left.neibghours.down != nil {
-        r.sides++
+      currRegion := newRegion(len(g.regions), data[i][j])
+      g.labels[i][j] = currRegion.id
+      queue := []*gardenPlot{data[i][j]}
+      for len(queue) > 0 {
+        gp := queue[0]
+        queue = queue[1:]
+        currRegion.appendGardenPlot(gp)
+        for _, d := range directions {
+          newX := gp.x + d[0]
+          newY := gp.y + d[1]
+          if newX < 0 || newY < 0 || newX >= len(data) || newY >= len(data[newX]) {
+            continue
+          }
+          if g.labels[newX][newY] != -1 || data[newX][newY].symbol != currRegion.symbol {
+            continue
+          }
+          g.labels[newX][newY] = currRegion.id
+          queue = append(queue, data[newX][newY])
+        }
       }
+      g.regions = append(g.regions, currRegion)
     }
-    // Check left
-    if gp.neibghours.left == nil {
-      if gp.neibghours.up == nil {
-        r.sides++
-      } else if gp.neibghours.up.neibghours.left != nil {
-        r.sides++
+  }
+  for i := range data {
+    for j := range data[i] {
+      label := g.labels[i][j]
+      currRegion := g.regions[label]
+      for _, d := range directions {
+        if !g.sameRegion(i+d[0], j+d[1], label) {
+          currRegion.perimiter++
+        }
       }
-    }
-    // Check right
-    if gp.neibghours.right == nil {
-      if gp.neibghours.up == nil {
-        r.sides++
-      } else if gp.neibghours.up.neibghours.right != nil {
-        r.sides++
+      // Check the four corners of the plot
+      for _, c := range [][]int{{-1,-1}, {-1,1}, {1,-1}, {1,1}} {
+        vertical := g.sameRegion(i+c[0], j, label)
+        horizontal := g.sameRegion(i, j+c[1], label)
+        diagonal := g.sameRegion(i+c[0], j+c[1], label)
+        if !vertical && !horizontal {
+          currRegion.sides++
+        } else if vertical && horizontal && !diagonal {
+          currRegion.sides++
+        }
       }
     }
   }
+  return g
 }
 
 func printData(d [][]*gardenPlot) {
@@ -207,10 +158,16 @@ func readInput(path string) ([][]*gardenPlot, error) {
     return data, err
   }
   scanner := bufio.NewScanner(file)
-  i := -1
+  var lines []string
   for scanner.Scan() {
-    i++
-    line := scanner.Text()
+    lines = append(lines, scanner.Text())
+  }
+  return parseGarden(lines), nil
+}
+
+func parseGarden(lines []string) [][]*gardenPlot {
+  var data [][]*gardenPlot
+  for i, line := range lines {
     splitLine := strings.Split(line, "")
     row := make([]*gardenPlot, len(splitLine))
     for j, s := range splitLine {
@@ -218,75 +175,318 @@ func readInput(path string) ([][]*gardenPlot, error) {
     }
     data = append(data, row)
   }
-  return data, nil
+  return data
 }
 
-func containsPlot(gps []*gardenPlot, gp *gardenPlot) bool {
-  for _, g := range gps {
-    if g.x == gp.x && g.y == gp.y && g.symbol == gp.symbol{
-      return true
+// Fences are walked with the region on their right, a fence walked east is
+// on the north side of its plot, south on the east side and so on
+const (
+  east = iota
+  south
+  west
+  north
+)
+
+type vertex struct {
+  row int
+  col int
+}
+
+type fence struct {
+  from      vertex
+  to        vertex
+  direction int
+}
+
+// boundary is one closed loop of fences, outer boundaries go clockwise and
+// have a positive area while the boundaries of holes have a negative one
+type boundary struct {
+  vertices   []vertex
+  directions []int
+  area       int
+}
+
+func (g *garden) fences(r *region) []*fence {
+  var result []*fence
+  for _, gp := range r.gardenPlots {
+    top := vertex{row: gp.x, col: gp.y}
+    right := vertex{row: gp.x, col: gp.y+1}
+    bottom := vertex{row: gp.x+1, col: gp.y+1}
+    left := vertex{row: gp.x+1, col: gp.y}
+    checks := []struct {
+      dx, dy   int
+      from, to vertex
+      dir      int
+    }{
+      {-1, 0, top, right, east},
+      {0, 1, right, bottom, south},
+      {1, 0, bottom, left, west},
+      {0, -1, left, top, north},
+    }
+    for _, c := range checks {
+      if g.sameRegion(gp.x+c.dx, gp.y+c.dy, r.id) {
+        continue
+      }
+      result = append(result, &fence{from: c.from, to: c.to, direction: c.dir})
     }
   }
-  return false
+  return result
 }
 
-func mapRegion(data [][]*gardenPlot, x, y int, usedPlots *[]*gardenPlot, region *region) {
-  if x < 0 || y < 0 || x >= len(data) || y >= len(data[0]) {
-    return
+// traceBoundaries links the fences into loops, where two fences leave the
+// same vertex the walk turns right so it keeps hugging the region
+func traceBoundaries(fences []*fence) []*boundary {
+  outgoing := make(map[vertex][]*fence)
+  for _, f := range fences {
+    outgoing[f.from] = append(outgoing[f.from], f)
   }
-  if data[x][y].symbol != region.symbol {
-    return
+  used := make(map[*fence]bool)
+  var result []*boundary
+  for _, start := range fences {
+    if used[start] {
+      continue
+    }
+    var loop []*fence
+    curr := start
+    for curr != nil && !used[curr] {
+      used[curr] = true
+      loop = append(loop, curr)
+      var next *fence
+      for _, turn := range []int{1, 0, 3} {
+        for _, f := range outgoing[curr.to] {
+          if !used[f] && f.direction == (curr.direction+turn)%4 {
+            next = f
+            break
+          }
+        }
+        if next != nil {
+          break
+        }
+      }
+      curr = next
+    }
+    b := &boundary{}
+    for k, f := range loop {
+      if f.direction != loop[(k+len(loop)-1)%len(loop)].direction {
+        b.vertices = append(b.vertices, f.from)
+        b.directions = append(b.directions, f.direction)
+      }
+    }
+    for k := range b.vertices {
+      v1 := b.vertices[k]
+      v2 := b.vertices[(k+1)%len(b.vertices)]
+      b.area += v1.col*v2.row - v2.col*v1.row
+    }
+    b.area /= 2
+    result = append(result, b)
   }
-  if containsPlot(*usedPlots, data[x][y]) {
-    return
+  return result
+}
+
+// findHoles floods everything that isn't the region from the edge of its
+// bounding box, plots the flood can't reach are in holes of the region. The
+// flood also moves diagonally, like traceBoundaries it treats plots that
+// only touch at a corner as connected when they are outside the region
+func (g *garden) findHoles(r *region) [][]int {
+  height := r.maxX - r.minX + 3
+  width := r.maxY - r.minY + 3
+  seen := make([][]bool, height)
+  for i := range seen {
+    seen[i] = make([]bool, width)
   }
-  region.appendGardenPlot(data[x][y])
-  *usedPlots = append(*usedPlots, data[x][y])
-  mapRegion(data, x+1, y, usedPlots, region)
-  mapRegion(data, x-1, y, usedPlots, region)
-  mapRegion(data, x, y+1, usedPlots, region)
-  mapRegion(data, x, y-1, usedPlots, region)
-  return
+  inRegion := func(i, j int) bool {
+    return g.sameRegion(i+r.minX-1, j+r.minY-1, r.id)
+  }
+  flood := func(startI, startJ int) [][]int {
+    var cells [][]int
+    queue := [][]int{{startI, startJ}}
+    seen[startI][startJ] = true
+    for len(queue) > 0 {
+      c := queue[0]
+      queue = queue[1:]
+      cells = append(cells, c)
+      for _, d := range [][]int{{1,0}, {-1,0}, {0,1}, {0,-1}, {1,1}, {1,-1}, {-1,1}, {-1,-1}} {
+        i, j := c[0]+d[0], c[1]+d[1]
+        if i < 0 || j < 0 || i >= height || j >= width || seen[i][j] || inRegion(i, j) {
+          continue
+        }
+        seen[i][j] = true
+        queue = append(queue, []int{i, j})
+      }
+    }
+    return cells
+  }
+  flood(0, 0)
+  var holes [][]int
+  for i := range height {
+    for j := range width {
+      if seen[i][j] || inRegion(i, j) {
+        continue
+      }
+      var labels []int
+      for _, c := range flood(i, j) {
+        label := g.labels[c[0]+r.minX-1][c[1]+r.minY-1]
+        if !slices.Contains(labels, label) {
+          labels = append(labels, label)
+        }
+      }
+      holes = append(holes, labels)
+    }
+  }
+  return holes
 }
 
-func task1(data [][]*gardenPlot, debug bool) {
+// measureGeometry finds the boundaries and holes of every region, a region
+// inside a hole is enclosed by the innermost region around it, which is the
+// one that is itself enclosed by all the others
+func (g *garden) measureGeometry() {
+  enclosers := make([][]int, len(g.regions))
+  for _, r := range g.regions {
+    r.boundaries = traceBoundaries(g.fences(r))
+    holes := g.findHoles(r)
+    r.holes = len(holes)
+    for _, labels := range holes {
+      for _, label := range labels {
+        enclosers[label] = append(enclosers[label], r.id)
+      }
+    }
+  }
+  for _, r := range g.regions {
+    for _, id := range enclosers[r.id] {
+      if r.enclosedBy == -1 || len(enclosers[id]) > len(enclosers[r.enclosedBy]) {
+        r.enclosedBy = id
+      }
+    }
+  }
+}
+
+func fencePrice(g *garden, rule string, weights []int) (int, error) {
   result := 0
-  var usedPlots []*gardenPlot
-  for i := range data {
-    for j := range data[i] {
-      if containsPlot(usedPlots, data[i][j]) {
-        continue
+  for _, r := range g.regions {
+    switch rule {
+    case "perimeter":
+      result += r.area*r.perimiter
+    case "sides":
+      result += r.area*r.sides
+    case "weighted":
+      sides := 0
+      for _, b := range r.boundaries {
+        for _, d := range b.directions {
+          // A fence walked east is on the north side of its plot, so the
+          // directions line up with the N,E,S,W order of the weights
+          sides += weights[d]
+        }
       }
-      currRegion := newRegion([]*gardenPlot{data[i][j]})
-      mapRegion(data, i, j, &usedPlots, currRegion)
-      currRegion.calculateArea()
-      currRegion.calculatePerimiter()
-      result += currRegion.area*currRegion.perimiter
-      if debug {
-        fmt.Println(currRegion)
+      result += r.area*sides
+    default:
+      return 0, fmt.Errorf("Unknown price rule %s, please use perimeter, sides or weighted", rule)
+    }
+  }
+  return result, nil
+}
+
+type regionJSON struct {
+  Id          int        `json:"id"`
+  Symbol      string     `json:"symbol"`
+  Area        int        `json:"area"`
+  Perimeter   int        `json:"perimeter"`
+  Sides       int        `json:"sides"`
+  BoundingBox [4]int     `json:"boundingBox"`
+  EnclosedBy  *int       `json:"enclosedBy,omitempty"`
+  Holes       int        `json:"holes"`
+  Rings       [][][2]int `json:"rings"`
+}
+
+// rings lists the outer boundaries first and then the holes, every ring is
+// closed and uses [x, y] corner coordinates like GeoJSON
+func (r *region) rings() [][][2]int {
+  ordered := slices.Clone(r.boundaries)
+  slices.SortStableFunc(ordered, func(b1, b2 *boundary) int {
+    return b2.area - b1.area
+  })
+  var result [][][2]int
+  for _, b := range ordered {
+    ring := make([][2]int, 0, len(b.vertices)+1)
+    for _, v := range b.vertices {
+      ring = append(ring, [2]int{v.col, v.row})
+    }
+    ring = append(ring, ring[0])
+    result = append(result, ring)
+  }
+  return result
+}
+
+func (r *region) toJSON() regionJSON {
+  result := regionJSON{
+    Id: r.id,
+    Symbol: r.symbol,
+    Area: r.area,
+    Perimeter: r.perimiter,
+    Sides: r.sides,
+    BoundingBox: [4]int{r.minX, r.minY, r.maxX, r.maxY},
+    Holes: r.holes,
+    Rings: r.rings(),
+  }
+  if r.enclosedBy != -1 {
+    enclosedBy := r.enclosedBy
+    result.EnclosedBy = &enclosedBy
+  }
+  return result
+}
+
+func exportRegions(g *garden, format string) (string, error) {
+  var content any
+  switch format {
+  case "json":
+    regions := make([]regionJSON, len(g.regions))
+    for i, r := range g.regions {
+      regions[i] = r.toJSON()
+    }
+    content = regions
+  case "geojson":
+    features := make([]map[string]any, len(g.regions))
+    for i, r := range g.regions {
+      properties := r.toJSON()
+      rings := properties.Rings
+      properties.Rings = nil
+      features[i] = map[string]any{
+        "type": "Feature",
+        "properties": properties,
+        "geometry": map[string]any{"type": "Polygon", "coordinates": rings},
       }
     }
+    content = map[string]any{"type": "FeatureCollection", "features": features}
+  default:
+    return "", fmt.Errorf("Unknown export format %s, please use json or geojson", format)
+  }
+  path, err := util.OutputsPath("day12." + format)
+  if err != nil {
+    return "", err
+  }
+  encoded, err := json.MarshalIndent(content, "", "  ")
+  if err != nil {
+    return "", err
+  }
+  return path, os.WriteFile(path, encoded, 0644)
+}
+
+func task1(data [][]*gardenPlot, debug bool) {
+  result := 0
+  for _, r := range labelRegions(data).regions {
+    result += r.area*r.perimiter
+    if debug {
+      fmt.Println(r)
+    }
   }
   fmt.Printf("Task 1: %d\n", result)
 }
 
 func task2(data [][]*gardenPlot, debug bool) {
   result := 0
-  var usedPlots []*gardenPlot
-  for i := range data {
-    for j := range data[i] {
-      if containsPlot(usedPlots, data[i][j]) {
-        continue
-      }
-      currRegion := newRegion([]*gardenPlot{data[i][j]})
-      mapRegion(data, i, j, &usedPlots, currRegion)
-      currRegion.calculateArea()
-      currRegion.calculatePerimiter()
-      currRegion.calculateSides()
-      result += currRegion.area*currRegion.sides
-      if debug {
-        fmt.Println(currRegion)
-      }
+  for _, r := range labelRegions(data).regions {
+    result += r.area*r.sides
+    if debug {
+      fmt.Println(r)
     }
   }
   fmt.Printf("Task 2: %d\n", result)
@@ -313,12 +513,101 @@ func Run(path string, taskId int, debug bool) error {
   return nil
 }
 
+// RunCommand answers one of the region queries instead of the puzzle tasks,
+// args are the arguments that follow the command name
+func RunCommand(path string, command string, args []string, debug bool, weights []int) error {
+  data, err := readInput(path)
+  if err != nil {
+    return err
+  }
+  g := labelRegions(data)
+  g.measureGeometry()
+  switch command {
+  case "holes":
+    for _, r := range g.regions {
+      if r.holes > 0 {
+        fmt.Printf("Region %d (%s) has %d holes\n", r.id, r.symbol, r.holes)
+      }
+      if r.enclosedBy != -1 {
+        outer := g.regions[r.enclosedBy]
+        fmt.Printf("Region %d (%s) is enclosed by region %d (%s)\n", r.id, r.symbol, outer.id, outer.symbol)
+      }
+    }
+  case "boundaries":
+    for _, r := range g.regions {
+      fmt.Printf("Region %d (%s):\n", r.id, r.symbol)
+      for _, ring := range r.rings() {
+        fmt.Printf("  %v\n", ring)
+      }
+    }
+  case "price":
+    if len(args) == 0 || strings.HasPrefix(args[0], "--") {
+      return errors.New("Command price needs a rule: perimeter, sides or weighted")
+    }
+    price, err := fencePrice(g, args[0], weights)
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Fence price with the %s rule: %d\n", args[0], price)
+  case "export":
+    if len(args) == 0 || strings.HasPrefix(args[0], "--") {
+      return errors.New("Command export needs a format: json or geojson")
+    }
+    outPath, err := exportRegions(g, args[0])
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Regions written to: %s\n", outPath)
+  default:
+    return fmt.Errorf("Unknown command %s, please use holes, boundaries, price or export", command)
+  }
+  if debug {
+    for _, r := range g.regions {
+      fmt.Println(r)
+    }
+  }
+  return nil
+}
+
+func parseWeights(value string) ([]int, error) {
+  splitValue := strings.Split(value, ",")
+  if len(splitValue) != 4 {
+    return nil, errors.New("Weights have to be four numbers for the north, east, south and west sides")
+  }
+  weights := make([]int, 4)
+  for i, w := range splitValue {
+    weight, err := strconv.Atoi(w)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid weight: %s", w)
+    }
+    weights[i] = weight
+  }
+  return weights, nil
+}
+
 func main() {
   path, debug, err := util.ProcessArgs(os.Args[1:])
   if err != nil {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "--") {
+    weights := []int{1, 1, 1, 1}
+    if value, ok := util.ArgValue(os.Args[1:], "--weights"); ok {
+      weights, err = parseWeights(value)
+      if err != nil {
+        fmt.Printf("%v\nExiting!\n", err)
+        os.Exit(1)
+      }
+    }
+    tStart := time.Now()
+    err := RunCommand(path, os.Args[1], os.Args[2:], debug, weights)
+    if err != nil {
+      fmt.Println(err)
+    }
+    fmt.Printf("Command %s execution time: %v\n", os.Args[1], time.Since(tStart))
+    return
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
     err := Run(path, taskId, debug)
@@ -0,0 +1,115 @@
+package main
+
+import (
+  "math/rand"
+  "testing"
+)
+
+func measuredGarden(lines []string) *garden {
+  g := labelRegions(parseGarden(lines))
+  g.measureGeometry()
+  return g
+}
+
+func TestWeightedPriceSides(t *testing.T) {
+  // A has a notch on its south east corner, so every side gets a
+  // different total and a mix up between the weights shows
+  g := measuredGarden([]string{"AA", "AB"})
+  tests := []struct {
+    weights []int
+    want    int
+  }{
+    {[]int{1, 0, 0, 0}, 4},
+    {[]int{0, 1, 0, 0}, 7},
+    {[]int{0, 0, 1, 0}, 7},
+    {[]int{0, 0, 0, 1}, 4},
+    {[]int{1, 1, 1, 1}, 22},
+  }
+  for _, tt := range tests {
+    got, err := fencePrice(g, "weighted", tt.weights)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if got != tt.want {
+      t.Errorf("weighted price with weights %v = %d, want %d", tt.weights, got, tt.want)
+    }
+  }
+}
+
+func TestWeightedPriceMatchesSides(t *testing.T) {
+  g := measuredGarden([]string{"RRRRIICCFF", "RRRRIICCCF", "VVRRRCCFFF", "VVRCCCJFFF", "VVVVCJJCFE"})
+  sides, _ := fencePrice(g, "sides", nil)
+  weighted, _ := fencePrice(g, "weighted", []int{1, 1, 1, 1})
+  if sides != weighted {
+    t.Errorf("weighted price with unit weights = %d, want %d", weighted, sides)
+  }
+}
+
+func TestEnclosedByInnermost(t *testing.T) {
+  g := measuredGarden([]string{
+    "AAAAAAAAA",
+    "ABBBBBBBA",
+    "ABBBBBBBA",
+    "ABBBBBBBA",
+    "ABBBCBBBA",
+    "ABBBBBBBA",
+    "ABBBBBBBA",
+    "ABBBBBBBA",
+    "AAAAAAAAA",
+  })
+  want := map[string]string{"A": "", "B": "A", "C": "B"}
+  for _, r := range g.regions {
+    got := ""
+    if r.enclosedBy != -1 {
+      got = g.regions[r.enclosedBy].symbol
+    }
+    if got != want[r.symbol] {
+      t.Errorf("region %s is enclosed by %q, want %q", r.symbol, got, want[r.symbol])
+    }
+  }
+  if g.regions[0].holes != 1 || g.regions[1].holes != 1 {
+    t.Errorf("holes of A and B = %d and %d, want 1 and 1", g.regions[0].holes, g.regions[1].holes)
+  }
+}
+
+func holeRings(r *region) int {
+  result := 0
+  for _, b := range r.boundaries {
+    if b.area < 0 {
+      result++
+    }
+  }
+  return result
+}
+
+func TestHoleTouchingOutsideAtCorner(t *testing.T) {
+  // The C plot in the middle of the first B rows touches the outside only
+  // at a corner, so it isn't a hole of B
+  g := measuredGarden([]string{"BBA", "BCB", "BBB", "BBA", "CCB", "BBB", "CBB", "BAA"})
+  for _, r := range g.regions {
+    if r.holes != holeRings(r) {
+      t.Errorf("region %d (%s) has %d holes but %d hole rings", r.id, r.symbol, r.holes, holeRings(r))
+    }
+  }
+}
+
+func TestHolesMatchHoleRings(t *testing.T) {
+  rng := rand.New(rand.NewSource(12))
+  for range 3000 {
+    lines := make([]string, 3+rng.Intn(6))
+    width := 3 + rng.Intn(6)
+    for i := range lines {
+      line := make([]byte, width)
+      for j := range line {
+        line[j] = "ABC"[rng.Intn(3)]
+      }
+      lines[i] = string(line)
+    }
+    g := measuredGarden(lines)
+    for _, r := range g.regions {
+      if r.holes != holeRings(r) {
+        t.Fatalf("region %d (%s) of %v has %d holes but %d hole rings", r.id, r.symbol, lines, r.holes, holeRings(r))
+      }
+    }
+  }
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -84,42 +85,176 @@ func readInput(path string) ([]*machine, error) {
   return data, nil
 }
 
-func howToWin(m *machine, maxIter int) int {
-  cntB := ((m.prizeY*m.buttonA.dx)-(m.prizeX*m.buttonA.dy))/((m.buttonB.dy*m.buttonA.dx)-(m.buttonB.dx*m.buttonA.dy))
-  cntA := (m.prizeX-(cntB*m.buttonB.dx))/m.buttonA.dx
-  if maxIter != -1 && (cntA > maxIter || cntB > maxIter) {
-    return 0
+type solution struct {
+  pressA int
+  pressB int
+  cost   int
+}
+
+func (s *solution) String() string {
+  return fmt.Sprintf("A x%d, B x%d = %d tokens", s.pressA, s.pressB, s.cost)
+}
+
+func extendedGcd(a, b int) (int, int, int) {
+  if b == 0 {
+    return a, 1, 0
+  }
+  g, x, y := extendedGcd(b, a%b)
+  return g, y, x - (a/b)*y
+}
+
+func floorDiv(a, b int) int {
+  q := a / b
+  if (a%b != 0) && ((a < 0) != (b < 0)) {
+    q--
+  }
+  return q
+}
+
+func ceilDiv(a, b int) int {
+  return -floorDiv(-a, b)
+}
+
+// A press limit of noLimit lets the buttons be pressed any number of times,
+// unset means --max-presses wasn't given and each task uses its own limit
+const (
+  noLimit = -1
+  unset   = -2
+)
+
+// solveLine finds the cheapest non negative a and b with a*stepA + b*stepB
+// = target, every solution is a0 + k*stepB/g, b0 - k*stepA/g so the cost is
+// linear in k and the cheapest one is at one end of the allowed range of k
+func solveLine(stepA, stepB, target, costA, costB, maxPresses int) (int, int, bool) {
+  limit := maxPresses
+  if limit == noLimit {
+    limit = math.MaxInt / 4
+  }
+  if stepA == 0 && stepB == 0 {
+    return 0, 0, target == 0
+  }
+  if stepA == 0 || stepB == 0 {
+    step := stepA + stepB
+    if target%step != 0 || target/step < 0 || target/step > limit {
+      return 0, 0, false
+    }
+    if stepA == 0 {
+      return 0, target / step, true
+    }
+    return target / step, 0, true
+  }
+  g, x, y := extendedGcd(stepA, stepB)
+  if target%g != 0 {
+    return 0, 0, false
+  }
+  a0, b0 := x*(target/g), y*(target/g)
+  da, db := stepB/g, stepA/g
+  if da < 0 {
+    da, db = -da, -db
   }
-  finalX := (m.buttonA.dx*cntA) + (m.buttonB.dx*cntB)
-  if m.prizeX % finalX != 0 {
-    return 0
+  // a = a0 + k*da has to stay in [0, limit]
+  kMin := ceilDiv(-a0, da)
+  kMax := floorDiv(limit-a0, da)
+  // b = b0 - k*db has to stay in [0, limit]
+  if db > 0 {
+    kMin = max(kMin, ceilDiv(b0-limit, db))
+    kMax = min(kMax, floorDiv(b0, db))
+  } else {
+    kMin = max(kMin, ceilDiv(-b0, -db))
+    kMax = min(kMax, floorDiv(limit-b0, -db))
   }
-  finalY := (m.buttonA.dy*cntA) + (m.buttonB.dy*cntB)
-  if m.prizeY % finalY != 0 {
-    return 0
+  if kMin > kMax {
+    return 0, 0, false
   }
-  return (m.buttonA.cost*cntA) + (m.buttonB.cost*cntB)
+  k := kMin
+  if costA*da-costB*db < 0 {
+    k = kMax
+  }
+  return a0 + k*da, b0 - k*db, true
+}
+
+// howToWin solves the two equations with Cramer's rule, when the buttons
+// move the claw along the same line the problem becomes one equation along
+// that line
+func howToWin(m *machine, maxPresses int) (*solution, bool) {
+  a, b := m.buttonA, m.buttonB
+  det := a.dx*b.dy - a.dy*b.dx
+  var pressA, pressB int
+  if det != 0 {
+    numA := m.prizeX*b.dy - m.prizeY*b.dx
+    numB := a.dx*m.prizeY - a.dy*m.prizeX
+    if numA%det != 0 || numB%det != 0 {
+      return nil, false
+    }
+    pressA, pressB = numA/det, numB/det
+    if pressA < 0 || pressB < 0 {
+      return nil, false
+    }
+    if maxPresses != noLimit && (pressA > maxPresses || pressB > maxPresses) {
+      return nil, false
+    }
+  } else {
+    // The prize has to be on the line the buttons move along
+    if a.dx*m.prizeY-a.dy*m.prizeX != 0 || b.dx*m.prizeY-b.dy*m.prizeX != 0 {
+      return nil, false
+    }
+    var ok bool
+    if a.dx != 0 || b.dx != 0 {
+      pressA, pressB, ok = solveLine(a.dx, b.dx, m.prizeX, a.cost, b.cost, maxPresses)
+    } else {
+      pressA, pressB, ok = solveLine(a.dy, b.dy, m.prizeY, a.cost, b.cost, maxPresses)
+    }
+    if !ok {
+      return nil, false
+    }
+  }
+  if pressA*a.dx+pressB*b.dx != m.prizeX || pressA*a.dy+pressB*b.dy != m.prizeY {
+    return nil, false
+  }
+  return &solution{pressA: pressA, pressB: pressB, cost: pressA*a.cost + pressB*b.cost}, true
 }
 
-func task1(data []*machine) {
+func winAll(data []*machine, maxPresses int, debug bool) int {
   result := 0
-  for _, d := range data {
-    result += howToWin(d, 100)
+  for i, d := range data {
+    s, ok := howToWin(d, maxPresses)
+    if debug {
+      if ok {
+        fmt.Printf("Machine %d: %v\n", i+1, s)
+      } else {
+        fmt.Printf("Machine %d: prize can't be won\n", i+1)
+      }
+    }
+    if ok {
+      result += s.cost
+    }
+  }
+  return result
+}
+
+func task1(data []*machine, debug bool, maxPresses int) {
+  result := 0
+  if maxPresses == unset {
+    maxPresses = 100
   }
+  result = winAll(data, maxPresses, debug)
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data []*machine) {
+func task2(data []*machine, debug bool, maxPresses int) {
   result := 0
+  if maxPresses == unset {
+    maxPresses = noLimit
+  }
   for _, d := range data {
     d.prizeX += 10000000000000
     d.prizeY += 10000000000000
-    result += howToWin(d, -1)
   }
+  result = winAll(data, maxPresses, debug)
   fmt.Printf("Task 2: %d\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, maxPresses int) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -131,9 +266,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data)
+    task1(data, debug, maxPresses)
   case 2:
-    task2(data)
+    task2(data, debug, maxPresses)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -146,9 +281,17 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  maxPresses := unset
+  if _, ok := util.ArgValue(os.Args[1:], "--max-presses"); ok {
+    maxPresses, err = util.IntArg(os.Args[1:], "--max-presses", unset)
+    if err != nil || maxPresses < 0 {
+      fmt.Println("Maximum number of presses can't be negative\nExiting!")
+      os.Exit(1)
+    }
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, maxPresses)
     if err != nil {
       fmt.Println(err)
     }
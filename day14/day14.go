@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"image/color"
+	"math"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -64,26 +67,6 @@ func (r *robot) setQuadrant() {
   r.quadrant = 4
 }
 
-func (r *robot) move() {
-  if r.arena == nil {
-    fmt.Println("Can't move when arena is undefined")
-    return
-  }
-  r.p.x += r.v.x
-  if r.p.x < 0 {
-    r.p.x += r.arena.width
-  } else if r.p.x >= r.arena.width {
-    r.p.x -= r.arena.width
-  }
-  r.p.y += r.v.y
-  if r.p.y < 0 {
-    r.p.y += r.arena.height
-  } else if r.p.y >= r.arena.height {
-    r.p.y -= r.arena.height
-  }
-  r.setQuadrant()
-}
-
 type arena struct {
   width  int
   height int
@@ -102,42 +85,278 @@ func findMiddle(x int) int {
   return x/2 - 1
 }
 
+func wrap(x, size int) int {
+  return (x%size + size) % size
+}
+
+func (r *robot) moveTo(t int) {
+  if r.arena == nil {
+    fmt.Println("Can't move when arena is undefined")
+    return
+  }
+  r.p.x = wrap(r.p0.x+r.v.x*t, r.arena.width)
+  r.p.y = wrap(r.p0.y+r.v.y*t, r.arena.height)
+  r.setQuadrant()
+}
+
+func axisScore(values []int, size int, method string) float64 {
+  if method == "entropy" {
+    counts := make([]int, size)
+    for _, v := range values {
+      counts[v]++
+    }
+    entropy := 0.0
+    for _, c := range counts {
+      if c == 0 {
+        continue
+      }
+      p := float64(c) / float64(len(values))
+      entropy -= p * math.Log2(p)
+    }
+    return entropy
+  }
+  mean := 0.0
+  for _, v := range values {
+    mean += float64(v)
+  }
+  mean /= float64(len(values))
+  variance := 0.0
+  for _, v := range values {
+    variance += (float64(v) - mean) * (float64(v) - mean)
+  }
+  return variance / float64(len(values))
+}
+
+// bestTime finds the second within one period where the robots are the most
+// clustered along one axis, the confidence is how many standard deviations
+// that score is below the mean score of the period
+func bestTime(data []*robot, period int, position func(r *robot, t int) int, method string) (int, float64) {
+  scores := make([]float64, period)
+  values := make([]int, len(data))
+  for t := range period {
+    for i, r := range data {
+      values[i] = position(r, t)
+    }
+    scores[t] = axisScore(values, period, method)
+  }
+  best := 0
+  mean := 0.0
+  for t, score := range scores {
+    mean += score
+    if score < scores[best] {
+      best = t
+    }
+  }
+  mean /= float64(period)
+  deviation := 0.0
+  for _, score := range scores {
+    deviation += (score - mean) * (score - mean)
+  }
+  deviation = math.Sqrt(deviation / float64(period))
+  if deviation == 0 {
+    return best, 0
+  }
+  return best, (mean - scores[best]) / deviation
+}
+
+func extendedGcd(a, b int) (int, int, int) {
+  if b == 0 {
+    return a, 1, 0
+  }
+  g, x, y := extendedGcd(b, a%b)
+  return g, y, x - (a/b)*y
+}
+
+// crt finds t in [0, m*n) with t = a (mod m) and t = b (mod n)
+func crt(a, m, b, n int) (int, error) {
+  g, inverse, _ := extendedGcd(m, n)
+  if g != 1 {
+    return 0, fmt.Errorf("Arena sides %d and %d have to be coprime", m, n)
+  }
+  return wrap(a+m*wrap((b-a)*inverse, n), m*n), nil
+}
+
+func findEasterEgg(data []*robot, arena *arena, method string) (int, float64, error) {
+  if len(data) == 0 {
+    return 0, 0, errors.New("No robots to look for an easter egg")
+  }
+  tx, confidenceX := bestTime(data, arena.width, func(r *robot, t int) int {
+    return wrap(r.p0.x+r.v.x*t, arena.width)
+  }, method)
+  ty, confidenceY := bestTime(data, arena.height, func(r *robot, t int) int {
+    return wrap(r.p0.y+r.v.y*t, arena.height)
+  }, method)
+  result, err := crt(tx, arena.width, ty, arena.height)
+  if err != nil {
+    return 0, 0, err
+  }
+  if result == 0 {
+    result = arena.width * arena.height
+  }
+  return result, min(confidenceX, confidenceY), nil
+}
+
 func printData(d []*robot) {
   for _, r := range d {
     fmt.Printf("%v --> quadrant %d\n", r, r.quadrant)
   }
 }
 
-func printImage(d []*robot) {
-  image := make([][]string, d[0].arena.height)
-  for i := range image {
-    row := make([]string, d[0].arena.width)
+func robotGrid(d []*robot) [][]rune {
+  grid := make([][]rune, d[0].arena.height)
+  for i := range grid {
+    row := make([]rune, d[0].arena.width)
     for j := range row {
-      row[j] = "."
+      row[j] = rune('.')
     }
-    image[i] = row
+    grid[i] = row
   }
   for _, r := range d {
-    image[r.p.y][r.p.x] = "#"
+    grid[r.p.y][r.p.x] = rune('#')
+  }
+  return grid
+}
+
+func printImage(d []*robot) {
+  for _, row := range robotGrid(d) {
+    fmt.Println(string(row))
+  }
+}
+
+var palette = util.Palette{
+  rune('.'): color.RGBA{R: 15, G: 15, B: 35, A: 255},
+  rune('#'): color.RGBA{R: 0, G: 204, B: 0, A: 255},
+}
+
+type options struct {
+  png     bool
+  gif     bool
+  frames  int
+  method  string
+  width   int
+  height  int
+  seconds int
+}
+
+// unset marks an arena size or number of seconds that wasn't given, 0 is a
+// valid number of seconds so it can't be used for that
+const unset = -1
+
+func newOptions() options {
+  return options{width: unset, height: unset, seconds: unset}
+}
+
+// resolveOptions fills in the arena size and the number of seconds, flags
+// take precedence over the input header, a side of the arena that neither
+// sets is detected from the robot positions on that axis
+func resolveOptions(opts, header options, data []*robot) options {
+  if opts.width == unset {
+    opts.width = header.width
+  }
+  if opts.height == unset {
+    opts.height = header.height
+  }
+  if opts.seconds == unset {
+    opts.seconds = header.seconds
   }
-  for i := range image {
-    for j := range image[i] {
-      fmt.Print(image[i][j])
+  if opts.seconds == unset {
+    opts.seconds = 100
+  }
+  maxX, maxY := 0, 0
+  for _, r := range data {
+    maxX = max(maxX, r.p0.x)
+    maxY = max(maxY, r.p0.y)
+  }
+  if opts.width == unset {
+    opts.width = 101
+    if maxX < 11 {
+      opts.width = 11
+    }
+  }
+  if opts.height == unset {
+    opts.height = 103
+    if maxY < 7 {
+      opts.height = 7
+    }
+  }
+  return opts
+}
+
+func parseHeader(line string, header *options) error {
+  for _, field := range strings.Fields(line) {
+    key, value, ok := strings.Cut(field, "=")
+    if !ok {
+      return fmt.Errorf("Invalid header field: %s", field)
+    }
+    switch key {
+    case "arena":
+      size := strings.Split(value, ",")
+      if len(size) != 2 {
+        return fmt.Errorf("Invalid arena size: %s", value)
+      }
+      width, err1 := strconv.Atoi(size[0])
+      height, err2 := strconv.Atoi(size[1])
+      if err1 != nil || err2 != nil || width < 1 || height < 1 {
+        return fmt.Errorf("Invalid arena size: %s", value)
+      }
+      header.width, header.height = width, height
+    case "seconds":
+      seconds, err := strconv.Atoi(value)
+      if err != nil || seconds < 0 {
+        return fmt.Errorf("Invalid number of seconds: %s", value)
+      }
+      header.seconds = seconds
+    default:
+      return fmt.Errorf("Unknown header field: %s", key)
+    }
+  }
+  return nil
+}
+
+func exportImages(frames [][][]rune, export options) error {
+  if export.png {
+    path, err := util.OutputsPath("day14.png")
+    if err != nil {
+      return err
+    }
+    err = util.WritePNG(path, frames[len(frames)-1], palette, 4)
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Easter egg picture written to: %s\n", path)
+  }
+  if export.gif {
+    path, err := util.OutputsPath("day14.gif")
+    if err != nil {
+      return err
     }
-    fmt.Println()
+    err = util.WriteGIF(path, frames, palette, 2, 10)
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Simulation written to: %s\n", path)
   }
+  return nil
 }
 
-func readInput(path string) ([]*robot, error) {
+func readInput(path string) ([]*robot, options, error) {
   var data []*robot
+  header := newOptions()
   file, err := os.Open(path)
   defer file.Close()
   if err != nil {
-    return data, err
+    return data, header, err
   }
   scanner := bufio.NewScanner(file)
   for scanner.Scan() {
     line := scanner.Text()
+    if !strings.HasPrefix(line, "p=") {
+      err := parseHeader(line, &header)
+      if err != nil {
+        return data, header, err
+      }
+      continue
+    }
     splitLine := strings.Split(line, " ")
     pLine := strings.Split(strings.Split(splitLine[0], "=")[1], ",")
     px, _ := strconv.Atoi(pLine[0])
@@ -147,21 +366,11 @@ func readInput(path string) ([]*robot, error) {
     vy, _ := strconv.Atoi(vLine[1])
     data = append(data, newRobot(newPoint(px, py), newPoint(vx, vy)))
   }
-  return data, nil
+  return data, header, nil
 }
 
-func containsPoint(s []*point, p *point) bool {
-  for _, ps := range s {
-    if ps.x == p.x && ps.y == p.y {
-      return true
-    }
-  }
-  return false
-}
-
-func task1(data []*robot, debug bool) {
+func task1(data []*robot, debug bool, opts options) {
   result := 0
-  nSeconds := 100
   counter := map [int]int{
     0: 0,
     1: 0,
@@ -169,68 +378,75 @@ func task1(data []*robot, debug bool) {
     3: 0,
     4: 0,
   }
-  arena := newArena(101, 103)
+  arena := newArena(opts.width, opts.height)
   for _, r := range data {
     r.arena = arena
-    for range nSeconds {
-      r.move()
-    }
+    r.moveTo(opts.seconds)
     counter[r.quadrant]++
   }
   if debug {
-    fmt.Printf("\nAfter %d seconds:\n", nSeconds)
+    fmt.Printf("\nAfter %d seconds:\n", opts.seconds)
     printData(data)
   }
   result = counter[1] * counter[2] * counter[3] * counter[4]
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data []*robot, debug bool) {
-  result := 0
-  arena := newArena(101, 103)
-  for {
-    result++
-    var points []*point
-    isEasterEgg := true
-    for _, r := range data {
-      r.arena = arena
-      r.move()
-      if !isEasterEgg {
-        continue
-      }
-      if containsPoint(points, r.p) {
-        isEasterEgg = false
-        continue
-      }
-      points = append(points, r.p)
+func task2(data []*robot, debug bool, opts options) {
+  arena := newArena(opts.width, opts.height)
+  for _, r := range data {
+    r.arena = arena
+  }
+  result, confidence, err := findEasterEgg(data, arena, opts.method)
+  if err != nil {
+    fmt.Println(err)
+    return
+  }
+  var frames [][][]rune
+  if opts.png || opts.gif {
+    firstFrame := result
+    if opts.gif {
+      firstFrame = max(0, result-opts.frames+1)
     }
-    if !isEasterEgg {
-      continue
+    for t := firstFrame; t <= result; t++ {
+      for _, r := range data {
+        r.moveTo(t)
+      }
+      frames = append(frames, robotGrid(data))
     }
-    if debug {
-      fmt.Println("Easter egg picture:")
-      printImage(data)
+  }
+  if debug {
+    for _, r := range data {
+      r.moveTo(result)
     }
-    break
+    fmt.Println("Easter egg picture:")
+    printImage(data)
+  }
+  err = exportImages(frames, opts)
+  if err != nil {
+    fmt.Println(err)
   }
   fmt.Printf("Task 2: %d\n", result)
+  fmt.Printf("Easter egg confidence: %.2f\n", confidence)
 }
 
-func Run(path string, taskId int, debug bool) error {
-  data, err := readInput(path)
+func Run(path string, taskId int, debug bool, opts options) error {
+  data, header, err := readInput(path)
   if err != nil {
     return err
   }
+  opts = resolveOptions(opts, header, data)
   if debug {
     fmt.Printf("\nRunning task %d\n", taskId)
+    fmt.Printf("Arena: %dx%d, seconds: %d\n", opts.width, opts.height, opts.seconds)
     fmt.Println("Starting data:")
     printData(data)
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -243,9 +459,41 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  frames, err := util.IntArg(os.Args[1:], "--frames", 100)
+  if err != nil || frames < 1 {
+    fmt.Println("Number of frames has to be a positive number\nExiting!")
+    os.Exit(1)
+  }
+  method, ok := util.ArgValue(os.Args[1:], "--method")
+  if !ok {
+    method = "variance"
+  }
+  if method != "variance" && method != "entropy" {
+    fmt.Println("Method has to be variance or entropy\nExiting!")
+    os.Exit(1)
+  }
+  opts := newOptions()
+  opts.png = slices.Contains(os.Args[1:], "--png")
+  opts.gif = slices.Contains(os.Args[1:], "--gif")
+  opts.frames = frames
+  opts.method = method
+  for _, name := range []string{"--width", "--height", "--seconds"} {
+    value, ok := util.ArgValue(os.Args[1:], name)
+    if !ok {
+      continue
+    }
+    number, err := strconv.Atoi(value)
+    if err != nil || number < 0 || (number == 0 && name != "--seconds") {
+      fmt.Println("Arena size has to be a positive number and seconds can't be negative\nExiting!")
+      os.Exit(1)
+    }
+  }
+  opts.width, _ = util.IntArg(os.Args[1:], "--width", unset)
+  opts.height, _ = util.IntArg(os.Args[1:], "--height", unset)
+  opts.seconds, _ = util.IntArg(os.Args[1:], "--seconds", unset)
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"adventOfCode2024/util"
@@ -14,12 +16,10 @@ import (
 type data struct {
   warehouse    [][]rune
   instructions []rune
-  robotX       int
-  robotY       int
 }
 
 func newData() *data {
-  return &data{warehouse: [][]rune{}, instructions: []rune{}, robotX: -1, robotY: -1}
+  return &data{warehouse: [][]rune{}, instructions: []rune{}}
 }
 
 func (d *data) printWarehouse() {
@@ -32,29 +32,322 @@ func (d *data) printInstructions() {
   fmt.Println(string(d.instructions))
 }
 
-func (d *data) widenWarehouse() {
-  newWarehouse := make([][]rune, len(d.warehouse))
-  for i := range d.warehouse {
-    row := make([]rune, len(d.warehouse[i])*2)
-    for j := range d.warehouse[i] {
-      switch d.warehouse[i][j] {
+type options struct {
+  log   bool
+  undo  int
+  scale scale
+  gps   string
+  check bool
+}
+
+// scale is how many cells wide and tall every cell of the map becomes
+type scale struct {
+  width  int
+  height int
+}
+
+func parseScale(value string) (scale, error) {
+  splitValue := strings.Split(value, "x")
+  if len(splitValue) != 2 {
+    return scale{}, fmt.Errorf("Invalid scale %s, please use NxM like 2x1", value)
+  }
+  width, err1 := strconv.Atoi(splitValue[0])
+  height, err2 := strconv.Atoi(splitValue[1])
+  if err1 != nil || err2 != nil || width < 1 || height < 1 {
+    return scale{}, fmt.Errorf("Invalid scale %s, please use NxM like 2x1", value)
+  }
+  return scale{width: width, height: height}, nil
+}
+
+type box struct {
+  id     int
+  x      int
+  y      int
+  width  int
+  height int
+}
+
+type moveRecord struct {
+  step        int
+  instruction rune
+  pushed      []int
+  blocked     bool
+}
+
+func (m *moveRecord) String() string {
+  if m.blocked {
+    return fmt.Sprintf("Step %d: %s blocked", m.step, string(m.instruction))
+  }
+  return fmt.Sprintf("Step %d: %s pushed %d boxes %v", m.step, string(m.instruction), len(m.pushed), m.pushed)
+}
+
+// warehouse keeps the robot and the boxes as objects, occupied holds the id
+// of the box covering every cell or -1 for cells without a box
+type warehouse struct {
+  walls    [][]bool
+  occupied [][]int
+  boxes    []*box
+  robotX   int
+  robotY   int
+  undo     []*moveRecord
+  log      []*moveRecord
+}
+
+// newWarehouse builds the warehouse with every cell of the map repeated to
+// fill sc, so boxes become sc.width cells wide and sc.height cells tall
+func newWarehouse(grid [][]rune, sc scale) (*warehouse, error) {
+  w := &warehouse{robotX: -1, robotY: -1}
+  for i := range grid {
+    for range sc.height {
+      occupied := make([]int, len(grid[i])*sc.width)
+      for j := range occupied {
+        occupied[j] = -1
+      }
+      w.walls = append(w.walls, make([]bool, len(grid[i])*sc.width))
+      w.occupied = append(w.occupied, occupied)
+    }
+    for j, cell := range grid[i] {
+      x, y := i*sc.height, j*sc.width
+      switch cell {
       case rune('#'):
-        row[j*2] = rune('#')
-        row[j*2+1] = rune('#')
+        for dx := range sc.height {
+          for dy := range sc.width {
+            w.walls[x+dx][y+dy] = true
+          }
+        }
       case rune('O'):
-        row[j*2] = rune('[')
-        row[j*2+1] = rune(']')
-      case rune('.'):
-        row[j*2] = rune('.')
-        row[j*2+1] = rune('.')
+        w.boxes = append(w.boxes, &box{id: len(w.boxes), x: x, y: y, width: sc.width, height: sc.height})
+        w.place(w.boxes[len(w.boxes)-1])
       case rune('@'):
-        row[j*2] = rune('@')
-        row[j*2+1] = rune('.')
+        w.robotX, w.robotY = x, y
       }
     }
-    newWarehouse[i] = row
   }
-  d.warehouse = newWarehouse
+  if w.robotX == -1 {
+    return nil, errors.New("There is no robot in the warehouse")
+  }
+  return w, nil
+}
+
+func (w *warehouse) place(b *box) {
+  for dx := range b.height {
+    for dy := range b.width {
+      w.occupied[b.x+dx][b.y+dy] = b.id
+    }
+  }
+}
+
+func (w *warehouse) lift(b *box) {
+  for dx := range b.height {
+    for dy := range b.width {
+      w.occupied[b.x+dx][b.y+dy] = -1
+    }
+  }
+}
+
+// pushed finds every box that moves when the robot steps by dx, dy, the
+// push is blocked when any of them would run into a wall
+func (w *warehouse) pushed(dx, dy int) ([]int, bool) {
+  var result []int
+  seen := make(map[int]bool)
+  queue := [][]int{{w.robotX + dx, w.robotY + dy}}
+  for len(queue) > 0 {
+    x, y := queue[0][0], queue[0][1]
+    queue = queue[1:]
+    if w.walls[x][y] {
+      return nil, true
+    }
+    id := w.occupied[x][y]
+    if id == -1 || seen[id] {
+      continue
+    }
+    seen[id] = true
+    result = append(result, id)
+    b := w.boxes[id]
+    for i := range b.height {
+      for j := range b.width {
+        nx, ny := b.x+i+dx, b.y+j+dy
+        if w.occupied[nx][ny] != id {
+          queue = append(queue, []int{nx, ny})
+        }
+      }
+    }
+  }
+  return result, false
+}
+
+// shift moves all the boxes at once, so boxes pushing each other never
+// overwrite one another
+func (w *warehouse) shift(ids []int, dx, dy int) {
+  for _, id := range ids {
+    w.lift(w.boxes[id])
+  }
+  for _, id := range ids {
+    b := w.boxes[id]
+    b.x += dx
+    b.y += dy
+    w.place(b)
+  }
+  w.robotX += dx
+  w.robotY += dy
+}
+
+func (w *warehouse) Move(instruction rune) (*moveRecord, error) {
+  record := &moveRecord{step: len(w.log) + 1, instruction: instruction}
+  dx, dy, err := translateInstruction(instruction)
+  if err != nil {
+    return nil, fmt.Errorf("%v at step %d", err, record.step)
+  }
+  record.pushed, record.blocked = w.pushed(dx, dy)
+  if !record.blocked {
+    w.shift(record.pushed, dx, dy)
+  }
+  w.undo = append(w.undo, record)
+  w.log = append(w.log, record)
+  return record, nil
+}
+
+// Undo reverts the last move that hasn't been undone yet, the move log
+// keeps every move so it can still be replayed
+func (w *warehouse) Undo() bool {
+  if len(w.undo) == 0 {
+    return false
+  }
+  record := w.undo[len(w.undo)-1]
+  w.undo = w.undo[:len(w.undo)-1]
+  if record.blocked {
+    return true
+  }
+  dx, dy, _ := translateInstruction(record.instruction)
+  w.shift(record.pushed, -dx, -dy)
+  return true
+}
+
+// gpsRules measure the distance of a box from the top and the left of the
+// warehouse, the GPS coordinate is 100 times the first plus the second
+var gpsRules = map[string]func(w *warehouse, b *box) (int, int){
+  "top-left": func(w *warehouse, b *box) (int, int) {
+    return b.x, b.y
+  },
+  "nearest-edge": func(w *warehouse, b *box) (int, int) {
+    bottom := len(w.walls) - b.x - b.height
+    right := len(w.walls[b.x]) - b.y - b.width
+    return min(b.x, bottom), min(b.y, right)
+  },
+}
+
+func (w *warehouse) GPS(rule string) (int, error) {
+  distance, ok := gpsRules[rule]
+  if !ok {
+    return 0, fmt.Errorf("Unknown GPS rule %s, please use top-left or nearest-edge", rule)
+  }
+  result := 0
+  for _, b := range w.boxes {
+    x, y := distance(w, b)
+    result += x*100 + y
+  }
+  return result, nil
+}
+
+func countCells(grid [][]rune) map[rune]int {
+  result := make(map[rune]int)
+  for i := range grid {
+    for j := range grid[i] {
+      result[grid[i][j]]++
+    }
+  }
+  return result
+}
+
+// checkInvariants makes sure a move kept every wall and box in place and
+// that no box overlaps a wall, another box or the robot
+func (w *warehouse) checkInvariants(before map[rune]int) error {
+  after := countCells(w.Render())
+  if after[rune('#')] != before[rune('#')] {
+    return fmt.Errorf("Wall count changed from %d to %d", before[rune('#')], after[rune('#')])
+  }
+  if after[rune('@')] != 1 {
+    return errors.New("Robot is missing from the warehouse")
+  }
+  cells := 0
+  for _, b := range w.boxes {
+    cells += b.width*b.height
+    for dx := range b.height {
+      for dy := range b.width {
+        if w.walls[b.x+dx][b.y+dy] || w.occupied[b.x+dx][b.y+dy] != b.id {
+          return fmt.Errorf("Box %d overlaps something at %d,%d", b.id, b.x+dx, b.y+dy)
+        }
+      }
+    }
+  }
+  boxCells := len(w.walls)*len(w.walls[0]) - after[rune('#')] - after[rune('.')] - after[rune('@')]
+  if boxCells != cells {
+    return fmt.Errorf("Box cells changed from %d to %d", cells, boxCells)
+  }
+  occupiedCells := 0
+  for i := range w.occupied {
+    for j := range w.occupied[i] {
+      if w.occupied[i][j] != -1 {
+        occupiedCells++
+      }
+    }
+  }
+  if occupiedCells != cells {
+    return fmt.Errorf("%d cells are marked as boxes but the boxes cover %d", occupiedCells, cells)
+  }
+  return nil
+}
+
+func (w *warehouse) Render() [][]rune {
+  result := make([][]rune, len(w.walls))
+  for i := range w.walls {
+    result[i] = make([]rune, len(w.walls[i]))
+    for j := range w.walls[i] {
+      result[i][j] = rune('.')
+      if w.walls[i][j] {
+        result[i][j] = rune('#')
+      }
+    }
+  }
+  for _, b := range w.boxes {
+    for dx := range b.height {
+      row := result[b.x+dx]
+      if b.width == 1 {
+        row[b.y] = rune('O')
+        continue
+      }
+      for dy := range b.width {
+        row[b.y+dy] = rune('-')
+      }
+      row[b.y] = rune('[')
+      row[b.y+b.width-1] = rune(']')
+    }
+  }
+  result[w.robotX][w.robotY] = rune('@')
+  return result
+}
+
+func (w *warehouse) Print() {
+  for _, row := range w.Render() {
+    fmt.Println(string(row))
+  }
+}
+
+func (w *warehouse) writeLog(fileName string) (string, error) {
+  path, err := util.OutputsPath(fileName)
+  if err != nil {
+    return "", err
+  }
+  file, err := os.Create(path)
+  if err != nil {
+    return "", err
+  }
+  defer file.Close()
+  writer := bufio.NewWriter(file)
+  for _, record := range w.log {
+    fmt.Fprintln(writer, record)
+  }
+  return path, writer.Flush()
 }
 
 func printData(d *data) {
@@ -81,175 +374,103 @@ func readInput(path string) (*data, error) {
     d.warehouse = append(d.warehouse, []rune(line))
   }
   // Instructions
+  lineNumber := len(d.warehouse) + 1
   for scanner.Scan() {
-    line := scanner.Text()
-    d.instructions = slices.Concat(d.instructions, []rune(line))
-  }
-  return d, nil
-}
-
-func findRobot(d *data) (int, int) {
-  for i := range d.warehouse {
-    for j := range d.warehouse[i] {
-      if d.warehouse[i][j] == rune('@') {
-        return i, j
+    lineNumber++
+    line := []rune(scanner.Text())
+    for col, instruction := range line {
+      _, _, err := translateInstruction(instruction)
+      if err != nil {
+        return d, fmt.Errorf("%v at line %d, column %d", err, lineNumber, col+1)
       }
     }
+    d.instructions = slices.Concat(d.instructions, line)
   }
-  return -1, -1
+  return d, nil
 }
 
-func translateInstruction(instruction rune) (int, int) {
+func translateInstruction(instruction rune) (int, int, error) {
   switch instruction {
   case rune('^'):
-    return -1, 0
+    return -1, 0, nil
   case rune('v'):
-    return 1, 0
+    return 1, 0, nil
   case rune('>'):
-    return 0, 1
+    return 0, 1, nil
   case rune('<'):
-    return 0, -1
+    return 0, -1, nil
   default:
-    fmt.Printf("Instruction %v is invalid\n", string(instruction))
-    return 0, 0
+    return 0, 0, fmt.Errorf("Instruction %q is invalid", instruction)
   }
 }
 
-func move(d *data, x, y, dx, dy int) bool {
-  newX := x + dx
-  newY := y + dy
-  if d.warehouse[newX][newY] == rune('#') {
-    return false
-  }
-  if d.warehouse[newX][newY] == rune('.') {
-    d.warehouse[newX][newY] = d.warehouse[x][y]
-    d.warehouse[x][y] = rune('.')
-    return true
-  }
-  if move(d, newX, newY, dx, dy) {
-    d.warehouse[newX][newY] = d.warehouse[x][y]
-    d.warehouse[x][y] = rune('.')
-    return true
+func runRobot(d *data, taskId int, sc scale, debug bool, opts options) (int, error) {
+  w, err := newWarehouse(d.warehouse, sc)
+  if err != nil {
+    return 0, err
   }
-  return false
-}
-
-func checkMoveWideUD(d *data, x, y, dx, dy int, paired bool) bool {
-  newX := x + dx
-  newY := y + dy
-  if d.warehouse[newX][newY] == rune('#') {
-    return false
+  if debug && sc != (scale{width: 1, height: 1}) {
+    fmt.Printf("Warehouse after scaling by %dx%d\n", sc.width, sc.height)
+    w.Print()
   }
-  if d.warehouse[newX][newY] == rune('.') {
-    if !paired && d.warehouse[x][y] == rune(']') {
-      if !checkMoveWideUD(d, x, y-1, dx, dy, true) {
-        return false
-      }
-    } else if !paired && d.warehouse[x][y] == rune('[') {
-      if !checkMoveWideUD(d, x, y+1, dx, dy, true) {
-        return false
-      }
+  before := countCells(w.Render())
+  for _, instruction := range d.instructions {
+    _, err := w.Move(instruction)
+    if err != nil {
+      return 0, err
     }
-    return true
-  }
-  if checkMoveWideUD(d, newX, newY, dx, dy, false) {
-    if !paired && d.warehouse[x][y] == rune(']') {
-      if !checkMoveWideUD(d, x, y-1, dx, dy, true) {
-        return false
-      }
-    } else if !paired && d.warehouse[x][y] == rune('[') {
-      if !checkMoveWideUD(d, x, y+1, dx, dy, true) {
-        return false
+    if opts.check {
+      err = w.checkInvariants(before)
+      if err != nil {
+        return 0, fmt.Errorf("%v after step %d", err, len(w.log))
       }
     }
-    return true
   }
-  return false
-}
-
-func moveWideUD(d *data, x, y, dx, dy int, paired bool) {
-  newX := x + dx
-  newY := y + dy
-  if d.warehouse[newX][newY] == rune('#') {
-    return
+  if opts.check {
+    fmt.Printf("Walls and boxes checked after all %d moves\n", len(w.log))
+  }
+  for range opts.undo {
+    if !w.Undo() {
+      break
+    }
   }
-  if d.warehouse[newX][newY] == rune('.') {
-    if !paired && d.warehouse[x][y] == rune(']') {
-      moveWideUD(d, x, y-1, dx, dy, true)
-    } else if !paired && d.warehouse[x][y] == rune('[') {
-      moveWideUD(d, x, y+1, dx, dy, true)
+  if debug {
+    if opts.undo > 0 {
+      fmt.Printf("Warehouse after undoing %d moves:\n", opts.undo)
+    } else {
+      fmt.Println("Warehouse after all instructions:")
     }
-    d.warehouse[newX][newY] = d.warehouse[x][y]
-    d.warehouse[x][y] = rune('.')
-    return
+    w.Print()
   }
-  moveWideUD(d, newX, newY, dx, dy, false)
-  if !paired && d.warehouse[x][y] == rune(']') {
-    moveWideUD(d, x, y-1, dx, dy, true)
-  } else if !paired && d.warehouse[x][y] == rune('[') {
-    moveWideUD(d, x, y+1, dx, dy, true)
+  if opts.log {
+    path, err := w.writeLog(fmt.Sprintf("day15_task%d.log", taskId))
+    if err != nil {
+      return 0, err
+    }
+    fmt.Printf("Move log written to: %s\n", path)
   }
-  d.warehouse[newX][newY] = d.warehouse[x][y]
-  d.warehouse[x][y] = rune('.')
+  return w.GPS(opts.gps)
 }
 
-func task1(d *data, debug bool) {
-  result := 0
-  for _, instruction := range d.instructions {
-    robotX, robotY := findRobot(d)
-    dx, dy := translateInstruction(instruction)
-    move(d, robotX, robotY, dx, dy)
-  }
-  if debug {
-    fmt.Println("Warehouse after all instructions:")
-    d.printWarehouse()
-  }
-  for i := range d.warehouse {
-    for j := range d.warehouse[0] {
-      if d.warehouse[i][j] != rune('O') {
-        continue
-      }
-      result += i*100 + j
-    }
+func task1(d *data, debug bool, opts options) error {
+  result, err := runRobot(d, 1, scale{width: 1, height: 1}, debug, opts)
+  if err != nil {
+    return err
   }
   fmt.Printf("Task 1: %d\n", result)
+  return nil
 }
 
-func task2(d *data, debug bool) {
-  result := 0
-  d.widenWarehouse()
-  if debug {
-    fmt.Println("Warehouse after widening")
-    d.printWarehouse()
-  }
-  for _, instruction := range d.instructions {
-    robotX, robotY := findRobot(d)
-    dx, dy := translateInstruction(instruction)
-    switch instruction {
-    case rune('<'), rune('>'):
-      move(d, robotX, robotY, dx, dy)
-    case rune('^'), rune('v'):
-      if checkMoveWideUD(d, robotX, robotY, dx, dy, false) {
-        moveWideUD(d, robotX, robotY, dx, dy, false)
-      }
-    }
-  }
-  if debug {
-    fmt.Println("Warehouse after all instructions:")
-    d.printWarehouse()
-  }
-  for i := range d.warehouse {
-    for j := range d.warehouse[0] {
-      if d.warehouse[i][j] != rune('[') {
-        continue
-      }
-      result += i*100 + j
-    }
+func task2(d *data, debug bool, opts options) error {
+  result, err := runRobot(d, 2, opts.scale, debug, opts)
+  if err != nil {
+    return err
   }
   fmt.Printf("Task 2: %d\n", result)
+  return nil
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -261,13 +482,13 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    err = task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    err = task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
-  return nil
+  return err
 }
 
 func main() {
@@ -276,9 +497,28 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  opts := options{
+    log: slices.Contains(os.Args[1:], "--log"),
+    scale: scale{width: 2, height: 1},
+    gps: "top-left",
+    check: slices.Contains(os.Args[1:], "--check"),
+  }
+  opts.undo, err = util.IntArg(os.Args[1:], "--undo", 0)
+  if err == nil {
+    if value, ok := util.ArgValue(os.Args[1:], "--scale"); ok {
+      opts.scale, err = parseScale(value)
+    }
+  }
+  if value, ok := util.ArgValue(os.Args[1:], "--gps"); ok {
+    opts.gps = value
+  }
+  if err != nil {
+    fmt.Printf("%v\nExiting!\n", err)
+    os.Exit(1)
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -0,0 +1,92 @@
+package main
+
+import (
+  "math/rand"
+  "testing"
+)
+
+// randomWarehouse builds a walled map with random boxes and inner walls and
+// the robot somewhere inside
+func randomWarehouse(rng *rand.Rand, height, width int) [][]rune {
+  grid := make([][]rune, height)
+  for i := range grid {
+    grid[i] = make([]rune, width)
+    for j := range grid[i] {
+      switch {
+      case i == 0 || j == 0 || i == height-1 || j == width-1:
+        grid[i][j] = rune('#')
+      case rng.Intn(10) < 3:
+        grid[i][j] = rune('O')
+      case rng.Intn(10) < 1:
+        grid[i][j] = rune('#')
+      default:
+        grid[i][j] = rune('.')
+      }
+    }
+  }
+  grid[1+rng.Intn(height-2)][1+rng.Intn(width-2)] = rune('@')
+  return grid
+}
+
+func randomInstructions(rng *rand.Rand, n int) []rune {
+  instructions := make([]rune, n)
+  for i := range instructions {
+    instructions[i] = []rune("^v<>")[rng.Intn(4)]
+  }
+  return instructions
+}
+
+func renderString(w *warehouse) string {
+  var result []rune
+  for _, row := range w.Render() {
+    result = append(result, row...)
+    result = append(result, rune('\n'))
+  }
+  return string(result)
+}
+
+func TestMovesKeepWallsAndBoxes(t *testing.T) {
+  rng := rand.New(rand.NewSource(15))
+  scales := []scale{{1, 1}, {2, 1}, {1, 2}, {2, 2}, {3, 2}}
+  for _, sc := range scales {
+    for range 20 {
+      grid := randomWarehouse(rng, 4+rng.Intn(8), 4+rng.Intn(8))
+      w, err := newWarehouse(grid, sc)
+      if err != nil {
+        t.Fatal(err)
+      }
+      start := renderString(w)
+      before := countCells(w.Render())
+      instructions := randomInstructions(rng, 200)
+      for step, instruction := range instructions {
+        if _, err := w.Move(instruction); err != nil {
+          t.Fatal(err)
+        }
+        if err := w.checkInvariants(before); err != nil {
+          t.Fatalf("scale %dx%d, step %d: %v\n%s", sc.width, sc.height, step+1, err, renderString(w))
+        }
+      }
+      for range instructions {
+        if !w.Undo() {
+          t.Fatalf("scale %dx%d: undo stack ran out early", sc.width, sc.height)
+        }
+      }
+      if got := renderString(w); got != start {
+        t.Fatalf("scale %dx%d: undoing every move gives\n%s\nwant\n%s", sc.width, sc.height, got, start)
+      }
+    }
+  }
+}
+
+func TestInvalidInstruction(t *testing.T) {
+  w, err := newWarehouse([][]rune{[]rune("####"), []rune("#@.#"), []rune("####")}, scale{1, 1})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := w.Move(rune('x')); err == nil {
+    t.Error("moving with an invalid instruction didn't fail")
+  }
+  if len(w.log) != 0 || len(w.undo) != 0 {
+    t.Error("invalid instruction was recorded as a move")
+  }
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"image/color"
 	"math"
 	"os"
 	"slices"
@@ -36,8 +37,10 @@ func newPriorityQueue() *priorityQueue{
 }
 
 func (pq *priorityQueue) Append(n *node) {
-  pq.data = append(pq.data, n)
-  pq.Sort()
+  idx, _ := slices.BinarySearchFunc(pq.data, n.cost+1, func(el *node, cost int) int {
+    return el.cost - cost
+  })
+  pq.data = slices.Insert(pq.data, idx, n)
 }
 
 func (pq *priorityQueue) Pop() *node {
@@ -46,18 +49,6 @@ func (pq *priorityQueue) Pop() *node {
   return outNode
 }
 
-func (pq *priorityQueue) Sort() {
-  slices.SortFunc(pq.data, func(n1, n2 *node) int {
-    if n1.cost == n2.cost {
-      return 0
-    }
-    if n1.cost < n2.cost {
-      return -1
-    }
-    return 1
-  })
-}
-
 func printData(d [][]rune) {
   for i := range d {
     for j := range d[i] {
@@ -67,6 +58,47 @@ func printData(d [][]rune) {
   }
 }
 
+var palette = util.Palette{
+  rune('#'): color.RGBA{R: 90, G: 90, B: 90, A: 255},
+  rune('.'): color.RGBA{R: 15, G: 15, B: 35, A: 255},
+  rune('O'): color.RGBA{R: 255, G: 215, B: 0, A: 255},
+  rune('S'): color.RGBA{R: 0, G: 204, B: 0, A: 255},
+  rune('E'): color.RGBA{R: 220, G: 20, B: 60, A: 255},
+}
+
+type options struct {
+  png      bool
+  svg      bool
+  costs    mazeCosts
+  maxPaths int
+}
+
+func exportImages(data [][]rune, paths [][]util.GridPoint, export options) error {
+  if export.png {
+    path, err := util.OutputsPath("day16.png")
+    if err != nil {
+      return err
+    }
+    err = util.WritePNG(path, data, palette, 8)
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Best paths written to: %s\n", path)
+  }
+  if export.svg {
+    path, err := util.OutputsPath("day16.svg")
+    if err != nil {
+      return err
+    }
+    err = util.WriteGridSVG(path, data, palette, paths, 16)
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Best paths written to: %s\n", path)
+  }
+  return nil
+}
+
 func readInput(path string) ([][]rune, error) {
   var data [][]rune
   file, err := os.Open(path)
@@ -104,120 +136,176 @@ func findEnd(data [][]rune) (int, int) {
   return -1, -1
 }
 
-func findShortest(data [][]rune, startX, startY, endX, endY int, startDir rune) (int, map[rune][][]int) {
+var directions = []rune{rune('^'), rune('>'), rune('v'), rune('<')}
+
+type mazeCosts struct {
+  step int
+  turn int
+}
+
+type mazeResult struct {
+  cost  int
+  tiles [][]bool
+  paths [][]util.GridPoint
+}
+
+func (m *mazeResult) TileCount() int {
+  result := 0
+  for i := range m.tiles {
+    for j := range m.tiles[i] {
+      if m.tiles[i][j] {
+        result++
+      }
+    }
+  }
+  return result
+}
+
+// solveMaze runs one Dijkstra over (x, y, direction) states and keeps every
+// predecessor that reaches a state with its best cost, walking back from the
+// end over the predecessors gives every tile on any best path
+func solveMaze(data [][]rune, costs mazeCosts, maxPaths int) *mazeResult {
+  startX, startY := findStart(data)
+  endX, endY := findEnd(data)
+  width := len(data[0])
+  stateId := func(x, y int, direction rune) int {
+    return (x*width+y)*len(directions) + slices.Index(directions, direction)
+  }
+  best := make([]int, len(data)*width*len(directions))
+  for i := range best {
+    best[i] = math.MaxInt
+  }
+  predecessors := make([][]*node, len(best))
   pq := newPriorityQueue()
-  pq.Append(newNode(startX, startY, startDir, 0))
-  costMatrix := make(map[rune][][]int)
-  costMatrix[rune('^')] = make([][]int, len(data))
-  costMatrix[rune('v')] = make([][]int, len(data))
-  costMatrix[rune('>')] = make([][]int, len(data))
-  costMatrix[rune('<')] = make([][]int, len(data))
-  for i := range data {
-    costMatrix[rune('^')][i] = make([]int, len(data[i]))
-    costMatrix[rune('v')][i] = make([]int, len(data[i]))
-    costMatrix[rune('>')][i] = make([]int, len(data[i]))
-    costMatrix[rune('<')][i] = make([]int, len(data[i]))
-    for j := range data[i] {
-      costMatrix[rune('^')][i][j] = math.MaxInt32
-      costMatrix[rune('v')][i][j] = math.MaxInt32
-      costMatrix[rune('>')][i][j] = math.MaxInt32
-      costMatrix[rune('<')][i][j] = math.MaxInt32
+  start := newNode(startX, startY, rune('>'), 0)
+  best[stateId(startX, startY, start.direction)] = 0
+  pq.Append(start)
+  endCost := -1
+  relax := func(from, to *node) {
+    id := stateId(to.x, to.y, to.direction)
+    if to.cost > best[id] {
+      return
     }
+    if to.cost < best[id] {
+      best[id] = to.cost
+      predecessors[id] = nil
+      pq.Append(to)
+    }
+    predecessors[id] = append(predecessors[id], from)
   }
-  costMatrix[rune('>')][startX][startY] = 0
   for len(pq.data) > 0 {
     currNode := pq.Pop()
+    if currNode.cost > best[stateId(currNode.x, currNode.y, currNode.direction)] {
+      continue
+    }
+    if endCost != -1 && currNode.cost > endCost {
+      break
+    }
     if currNode.x == endX && currNode.y == endY {
-      return currNode.cost, costMatrix
+      endCost = currNode.cost
+      continue
     }
-    // Check straight
     dx, dy := util.TranslateDirection(currNode.direction)
-    newX := currNode.x + dx
-    newY := currNode.y + dy
-    if data[newX][newY] != rune('#') {
-      newCost := currNode.cost + 1
-      if newCost < costMatrix[currNode.direction][newX][newY] {
-        costMatrix[currNode.direction][newX][newY] = newCost
-        pq.Append(newNode(newX, newY, currNode.direction, newCost))
-      }
+    if data[currNode.x+dx][currNode.y+dy] != rune('#') {
+      relax(currNode, newNode(currNode.x+dx, currNode.y+dy, currNode.direction, currNode.cost+costs.step))
     }
-    // Check right
-    newDirection := util.TurnRight(currNode.direction)
-    dx, dy = util.TranslateDirection(newDirection)
-    newX = currNode.x + dx
-    newY = currNode.y + dy
-    if data[newX][newY] != rune('#') {
-      newCost := currNode.cost + 1001
-      if newCost < costMatrix[newDirection][newX][newY] {
-        costMatrix[newDirection][currNode.x][currNode.y] = newCost-1
-        costMatrix[newDirection][newX][newY] = newCost
-        pq.Append(newNode(newX, newY, newDirection, newCost))
-      }
+    relax(currNode, newNode(currNode.x, currNode.y, util.TurnRight(currNode.direction), currNode.cost+costs.turn))
+    relax(currNode, newNode(currNode.x, currNode.y, util.TurnLeft(currNode.direction), currNode.cost+costs.turn))
+  }
+  result := &mazeResult{cost: endCost}
+  if endCost == -1 {
+    return result
+  }
+  result.tiles = make([][]bool, len(data))
+  for i := range data {
+    result.tiles[i] = make([]bool, width)
+  }
+  var ends []*node
+  for _, d := range directions {
+    if best[stateId(endX, endY, d)] == endCost {
+      ends = append(ends, newNode(endX, endY, d, endCost))
     }
-    // Check left
-    newDirection = util.TurnLeft(currNode.direction)
-    dx, dy = util.TranslateDirection(newDirection)
-    newX = currNode.x + dx
-    newY = currNode.y + dy
-    if data[newX][newY] != rune('#') {
-      newCost := currNode.cost + 1001
-      if newCost < costMatrix[newDirection][newX][newY] {
-        costMatrix[newDirection][currNode.x][currNode.y] = newCost-1
-        costMatrix[newDirection][newX][newY] = newCost
-        pq.Append(newNode(newX, newY, newDirection, newCost))
+  }
+  seen := make([]bool, len(best))
+  stack := slices.Clone(ends)
+  for len(stack) > 0 {
+    n := stack[len(stack)-1]
+    stack = stack[:len(stack)-1]
+    id := stateId(n.x, n.y, n.direction)
+    if seen[id] {
+      continue
+    }
+    seen[id] = true
+    result.tiles[n.x][n.y] = true
+    stack = append(stack, predecessors[id]...)
+  }
+  var walk func(n *node, path []util.GridPoint)
+  walk = func(n *node, path []util.GridPoint) {
+    if len(result.paths) >= maxPaths {
+      return
+    }
+    if len(path) == 0 || path[len(path)-1] != (util.GridPoint{Row: n.x, Col: n.y}) {
+      path = append(path, util.GridPoint{Row: n.x, Col: n.y})
+    }
+    id := stateId(n.x, n.y, n.direction)
+    if len(predecessors[id]) == 0 {
+      reversed := slices.Clone(path)
+      slices.Reverse(reversed)
+      result.paths = append(result.paths, reversed)
+      return
+    }
+    for _, p := range predecessors[id] {
+      walk(p, path)
+    }
+  }
+  for _, end := range ends {
+    walk(end, nil)
+  }
+  return result
+}
+
+func markTiles(data [][]rune, tiles [][]bool) [][]rune {
+  result := make([][]rune, len(data))
+  for i := range data {
+    result[i] = slices.Clone(data[i])
+    for j := range data[i] {
+      if tiles[i][j] && data[i][j] == rune('.') {
+        result[i][j] = rune('O')
       }
     }
   }
-  return -1, costMatrix
+  return result
 }
 
-func task1(data [][]rune, debug bool) {
+func task1(data [][]rune, debug bool, opts options) {
   result := 0
-  endX, endY := findStart(data)
-  startX, startY := findEnd(data)
-  result, _ = findShortest(data, startX, startY, endX, endY, rune('>'))
+  result = solveMaze(data, opts.costs, 0).cost
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data [][]rune, debug bool) {
+func task2(data [][]rune, debug bool, opts options) {
   result := 0
-  endX, endY := findStart(data)
-  startX, startY := findEnd(data)
-  shortestPath, costMatrix1 := findShortest(data, startX, startY, endX, endY, rune('>'))
-  _, costMatrix2 := findShortest(data, endX, endY, startX, startY, rune('^'))
-  _, costMatrix3 := findShortest(data, endX, endY, startX, startY, rune('>'))
-  _, costMatrix4 := findShortest(data, endX, endY, startX, startY, rune('v'))
-  _, costMatrix5 := findShortest(data, endX, endY, startX, startY, rune('<'))
-  for d := range costMatrix1 {
-    flippedDir := util.TurnRight(util.TurnRight(d))
-    for i := range costMatrix1[d] {
-      for j := range costMatrix1[d][i] {
-        for _, v := range []int{costMatrix2[flippedDir][i][j], 
-        costMatrix3[flippedDir][i][j], 
-        costMatrix4[flippedDir][i][j], 
-        costMatrix5[flippedDir][i][j]} {
-          flipSum := costMatrix1[d][i][j] + v
-          if flipSum == shortestPath {
-            data[i][j] = rune('O')
-          }
-        }
-      }
-    }
-  }
-  for i := range data {
-    for j := range data[i] {
-      if data[i][j] == rune('O') || data[i][j] == rune('S') || data[i][j] == rune('E') {
-        result++
-      }
-    }
+  maze := solveMaze(data, opts.costs, opts.maxPaths)
+  if maze.cost == -1 {
+    fmt.Println("Task 2: the end can't be reached")
+    return
   }
+  result = maze.TileCount()
+  marked := markTiles(data, maze.tiles)
   if debug {
-    printData(data)
+    fmt.Printf("Found %d best paths with cost %d\n", len(maze.paths), maze.cost)
+    printData(marked)
+  }
+  if opts.png || opts.svg {
+    err := exportImages(marked, maze.paths, opts)
+    if err != nil {
+      fmt.Println(err)
+    }
   }
   fmt.Printf("Task 2: %d\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -229,9 +317,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -244,9 +332,22 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  step, err1 := util.IntArg(os.Args[1:], "--step-cost", 1)
+  turn, err2 := util.IntArg(os.Args[1:], "--turn-cost", 1000)
+  maxPaths, err3 := util.IntArg(os.Args[1:], "--max-paths", 100)
+  if err := errors.Join(err1, err2, err3); err != nil || step < 1 || turn < 1 || maxPaths < 0 {
+    fmt.Println("Costs have to be positive and maximum number of paths can't be negative\nExiting!")
+    os.Exit(1)
+  }
+  opts := options{
+    png:      slices.Contains(os.Args[1:], "--png"),
+    svg:      slices.Contains(os.Args[1:], "--svg"),
+    costs:    mazeCosts{step: step, turn: turn},
+    maxPaths: maxPaths,
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"image/color"
 	"math"
 	"os"
 	"slices"
@@ -64,7 +65,7 @@ func printData(d [][]rune) {
   }
 }
 
-func readInput(path string, size int) ([][]rune, [][]int, error) {
+func newGrid(size int) [][]rune {
   data := make([][]rune, size+1)
   for i := range data {
     row := make([]rune, size+1)
@@ -73,21 +74,68 @@ func readInput(path string, size int) ([][]rune, [][]int, error) {
     }
     data[i] = row
   }
+  return data
+}
+
+func readInput(path string) ([][]int, error) {
   var corruptedData [][]int
   file, err := os.Open(path)
   defer file.Close()
   if err != nil {
-    return data, corruptedData, err
+    return corruptedData, err
   }
   scanner := bufio.NewScanner(file)
   for scanner.Scan() {
     line := scanner.Text()
     splitLine := strings.Split(line, ",")
-    x, _ := strconv.Atoi(splitLine[1])
-    y, _ := strconv.Atoi(splitLine[0])
+    if len(splitLine) != 2 {
+      return corruptedData, fmt.Errorf("Invalid byte position: %s", line)
+    }
+    x, err1 := strconv.Atoi(splitLine[1])
+    y, err2 := strconv.Atoi(splitLine[0])
+    if err1 != nil || err2 != nil {
+      return corruptedData, fmt.Errorf("Invalid byte position: %s", line)
+    }
     corruptedData = append(corruptedData, []int{x, y})
   }
-  return data, corruptedData, nil
+  return corruptedData, nil
+}
+
+type options struct {
+  svg      bool
+  size     int
+  bytes    int
+  strategy string
+}
+
+// unset marks a grid size or number of bytes that wasn't given, 0 fallen
+// bytes is a valid number so it can't be used for that
+const unset = -1
+
+// resolveOptions fills in the grid size and the number of fallen bytes for
+// task 1 when they are not set with flags, inputs that fit the 6x6 example
+// grid use the example values
+func resolveOptions(opts options, corruptedData [][]int) (options, error) {
+  maxCoord := 0
+  for _, cd := range corruptedData {
+    maxCoord = max(maxCoord, cd[0], cd[1])
+  }
+  if opts.size == unset {
+    opts.size = 70
+    if maxCoord <= 6 {
+      opts.size = 6
+    }
+  }
+  if opts.bytes == unset {
+    opts.bytes = 1024
+    if opts.size == 6 {
+      opts.bytes = 12
+    }
+  }
+  if maxCoord > opts.size {
+    return opts, fmt.Errorf("Byte positions don't fit in a grid of size %d", opts.size)
+  }
+  return opts, nil
 }
 
 func corruptData(data [][]rune, corruptedData [][]int, count int) {
@@ -100,7 +148,7 @@ func corruptData(data [][]rune, corruptedData [][]int, count int) {
   }
 }
 
-func shortestPath(data [][]rune, startX, startY, endX, endY int, debug bool) int {
+func shortestPath(data [][]rune, startX, startY, endX, endY int, debug bool) (int, [][]int) {
   minCost := -1
   pq := newPriorityQueue()
   costMatrix := make([][]int, len(data))
@@ -155,52 +203,247 @@ func shortestPath(data [][]rune, startX, startY, endX, endY int, debug bool) int
       fmt.Println()
     }
   }
-  return minCost
+  return minCost, costMatrix
+}
+
+func tracePath(costMatrix [][]int, endX, endY int) []util.GridPoint {
+  if costMatrix[endX][endY] == math.MaxInt32 {
+    return nil
+  }
+  path := []util.GridPoint{{Row: endX, Col: endY}}
+  x, y := endX, endY
+  for costMatrix[x][y] > 0 {
+    for _, d := range [][]int{{1,0}, {-1,0}, {0,1}, {0,-1}} {
+      newX := x + d[0]
+      newY := y + d[1]
+      if newX < 0 || newY < 0 || newX >= len(costMatrix) || newY >= len(costMatrix[0]) {
+        continue
+      }
+      if costMatrix[newX][newY] == costMatrix[x][y]-1 {
+        x, y = newX, newY
+        break
+      }
+    }
+    path = append(path, util.GridPoint{Row: x, Col: y})
+  }
+  slices.Reverse(path)
+  return path
+}
+
+var palette = util.Palette{
+  rune('#'): color.RGBA{R: 90, G: 90, B: 90, A: 255},
+  rune('.'): color.RGBA{R: 15, G: 15, B: 35, A: 255},
+}
+
+func exportSVG(data [][]rune, path []util.GridPoint) error {
+  outPath, err := util.OutputsPath("day18.svg")
+  if err != nil {
+    return err
+  }
+  err = util.WriteGridSVG(outPath, data, palette, [][]util.GridPoint{path}, 12)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Shortest path written to: %s\n", outPath)
+  return nil
+}
+
+type unionFind struct {
+  parent []int
+  rank   []int
+}
+
+func newUnionFind(n int) *unionFind {
+  parent := make([]int, n)
+  for i := range parent {
+    parent[i] = i
+  }
+  return &unionFind{parent: parent, rank: make([]int, n)}
+}
+
+func (uf *unionFind) Find(x int) int {
+  for uf.parent[x] != x {
+    uf.parent[x] = uf.parent[uf.parent[x]]
+    x = uf.parent[x]
+  }
+  return x
+}
+
+func (uf *unionFind) Union(a, b int) {
+  rootA := uf.Find(a)
+  rootB := uf.Find(b)
+  if rootA == rootB {
+    return
+  }
+  if uf.rank[rootA] < uf.rank[rootB] {
+    rootA, rootB = rootB, rootA
+  }
+  uf.parent[rootB] = rootA
+  if uf.rank[rootA] == uf.rank[rootB] {
+    uf.rank[rootA]++
+  }
+}
+
+func isBlocked(size int, corruptedData [][]int, count int, debug bool) bool {
+  data := newGrid(size)
+  corruptData(data, corruptedData, count)
+  if debug {
+    fmt.Printf("Data after %d corrupted bytes:\n", count)
+    printData(data)
+  }
+  minCost, _ := shortestPath(data, 0, 0, size, size, debug)
+  return minCost == -1
+}
+
+func firstBlockingLinear(size int, corruptedData [][]int, startCount int, debug bool) int {
+  if startCount > 0 && isBlocked(size, corruptedData, startCount, false) {
+    startCount = 0
+  }
+  data := newGrid(size)
+  for corruptCount := startCount; corruptCount <= len(corruptedData); corruptCount++ {
+    corruptData(data, corruptedData, corruptCount)
+    if debug {
+      fmt.Printf("Data after %d corrupted bytes:\n", corruptCount)
+      printData(data)
+    }
+    if minCost, _ := shortestPath(data, 0, 0, size, size, debug); minCost == -1 {
+      return corruptCount - 1
+    }
+  }
+  return -1
 }
 
-func task1(data [][]rune, corruptedData [][]int, debug bool) {
+func firstBlockingBinary(size int, corruptedData [][]int, debug bool) int {
+  if !isBlocked(size, corruptedData, len(corruptedData), debug) {
+    return -1
+  }
+  low, high := 0, len(corruptedData)
+  for low < high {
+    mid := (low + high) / 2
+    if isBlocked(size, corruptedData, mid, debug) {
+      high = mid
+    } else {
+      low = mid + 1
+    }
+  }
+  return low - 1
+}
+
+// firstBlockingUnionFind starts from the grid with every byte fallen and
+// removes the bytes in reverse order, the byte whose removal connects the
+// start and the end is the first one that blocks the path
+func firstBlockingUnionFind(size int, corruptedData [][]int) int {
+  side := size + 1
+  data := newGrid(size)
+  corruptData(data, corruptedData, len(corruptedData))
+  uf := newUnionFind(side * side)
+  connect := func(x, y int) {
+    for _, d := range [][]int{{1,0}, {-1,0}, {0,1}, {0,-1}} {
+      newX := x + d[0]
+      newY := y + d[1]
+      if newX < 0 || newY < 0 || newX >= side || newY >= side {
+        continue
+      }
+      if data[newX][newY] == rune('#') {
+        continue
+      }
+      uf.Union(x*side+y, newX*side+newY)
+    }
+  }
+  for i := range data {
+    for j := range data[i] {
+      if data[i][j] != rune('#') {
+        connect(i, j)
+      }
+    }
+  }
+  start, end := 0, side*side-1
+  if data[0][0] != rune('#') && data[size][size] != rune('#') && uf.Find(start) == uf.Find(end) {
+    return -1
+  }
+  for i := len(corruptedData) - 1; i >= 0; i-- {
+    x, y := corruptedData[i][0], corruptedData[i][1]
+    if slices.IndexFunc(corruptedData[:i], func(cd []int) bool { return cd[0] == x && cd[1] == y }) != -1 {
+      continue
+    }
+    data[x][y] = rune('.')
+    connect(x, y)
+    if data[0][0] != rune('#') && data[size][size] != rune('#') && uf.Find(start) == uf.Find(end) {
+      return i
+    }
+  }
+  return -1
+}
+
+func task1(data [][]rune, corruptedData [][]int, debug bool, opts options) {
   result := 0
-  corruptCount := 1024
+  corruptCount := opts.bytes
   corruptData(data, corruptedData, corruptCount)
   if debug {
     fmt.Printf("Data after %d corrupted bytes:\n", corruptCount)
     printData(data)
   }
-  result = shortestPath(data, 0, 0, len(data)-1, len(data[0])-1, debug)
+  result, costMatrix := shortestPath(data, 0, 0, len(data)-1, len(data[0])-1, debug)
+  if opts.svg {
+    err := exportSVG(data, tracePath(costMatrix, len(data)-1, len(data[0])-1))
+    if err != nil {
+      fmt.Println(err)
+    }
+  }
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data [][]rune, corruptedData [][]int, debug bool) {
-  resultx := 0
-  resulty := 0
-  for corruptCount := 1024; corruptCount < len(corruptedData); corruptCount++ {
-    corruptData(data, corruptedData, corruptCount)
+func task2(corruptedData [][]int, debug bool, opts options) {
+  results := make(map[string]int)
+  strategies := []string{opts.strategy}
+  if opts.strategy == "all" {
+    strategies = []string{"linear", "binary", "unionfind"}
+  }
+  for _, strategy := range strategies {
+    switch strategy {
+    case "linear":
+      results[strategy] = firstBlockingLinear(opts.size, corruptedData, min(opts.bytes, len(corruptedData)), debug)
+    case "binary":
+      results[strategy] = firstBlockingBinary(opts.size, corruptedData, debug)
+    case "unionfind":
+      results[strategy] = firstBlockingUnionFind(opts.size, corruptedData)
+    }
     if debug {
-      fmt.Printf("Data after %d corrupted bytes:\n", corruptCount)
-      printData(data)
+      fmt.Printf("Strategy %s: first blocking byte index %d\n", strategy, results[strategy])
     }
-    if shortestPath(data, 0, 0, len(data)-1, len(data[0])-1, debug) == -1 {
-      resultx = corruptedData[corruptCount-1][1]
-      resulty = corruptedData[corruptCount-1][0]
-      break
+  }
+  blocking := results[strategies[0]]
+  for _, strategy := range strategies[1:] {
+    if results[strategy] != blocking {
+      fmt.Printf("Strategies disagree: %v\n", results)
+      return
     }
   }
-  fmt.Printf("Task 2: %d,%d\n", resultx, resulty)
+  if blocking == -1 {
+    fmt.Println("Task 2: the path is never blocked")
+    return
+  }
+  fmt.Printf("Task 2: %d,%d\n", corruptedData[blocking][1], corruptedData[blocking][0])
 }
 
-func Run(path string, taskId int, debug bool) error {
-  data, corruptedData, err := readInput(path, 70)
+func Run(path string, taskId int, debug bool, opts options) error {
+  corruptedData, err := readInput(path)
+  if err != nil {
+    return err
+  }
+  opts, err = resolveOptions(opts, corruptedData)
   if err != nil {
     return err
   }
   if debug {
     fmt.Printf("\nRunning task %d\n", taskId)
+    fmt.Printf("Grid size: %d, fallen bytes: %d\n", opts.size, opts.bytes)
   }
   switch taskId {
   case 1:
-    task1(data, corruptedData, debug)
+    task1(newGrid(opts.size), corruptedData, debug, opts)
   case 2:
-    task2(data, corruptedData, debug)
+    task2(corruptedData, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -213,9 +456,31 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  size, err1 := util.IntArg(os.Args[1:], "--size", unset)
+  bytes, err2 := util.IntArg(os.Args[1:], "--bytes", unset)
+  _, sizeSet := util.ArgValue(os.Args[1:], "--size")
+  _, bytesSet := util.ArgValue(os.Args[1:], "--bytes")
+  if err := errors.Join(err1, err2); err != nil || (sizeSet && size < 1) || (bytesSet && bytes < 0) {
+    fmt.Println("Grid size has to be a positive number and the number of bytes can't be negative\nExiting!")
+    os.Exit(1)
+  }
+  strategy, ok := util.ArgValue(os.Args[1:], "--strategy")
+  if !ok {
+    strategy = "linear"
+  }
+  if !slices.Contains([]string{"linear", "binary", "unionfind", "all"}, strategy) {
+    fmt.Println("Strategy has to be linear, binary, unionfind or all\nExiting!")
+    os.Exit(1)
+  }
+  opts := options{
+    svg:      slices.Contains(os.Args[1:], "--svg"),
+    size:     size,
+    bytes:    bytes,
+    strategy: strategy,
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -5,26 +5,65 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"adventOfCode2024/util"
 )
 
+type trieNode struct {
+  children map[rune]*trieNode
+  terminal bool
+}
+
+func newTrieNode() *trieNode {
+  return &trieNode{children: make(map[rune]*trieNode)}
+}
+
+func newTrie(patterns []string) *trieNode {
+  root := newTrieNode()
+  for _, p := range patterns {
+    curr := root
+    for _, r := range p {
+      next, ok := curr.children[r]
+      if !ok {
+        next = newTrieNode()
+        curr.children[r] = next
+      }
+      curr = next
+    }
+    curr.terminal = true
+  }
+  return root
+}
+
+// Matches returns the end index of every pattern that matches the design
+// starting at index start
+func (t *trieNode) Matches(design []rune, start int) []int {
+  var result []int
+  curr := t
+  for i := start; i < len(design); i++ {
+    next, ok := curr.children[design[i]]
+    if !ok {
+      break
+    }
+    curr = next
+    if curr.terminal {
+      result = append(result, i+1)
+    }
+  }
+  return result
+}
+
 type input struct {
   patterns []string
-  designs []string
-  validDesigns map[string]bool
-  arrangementCount map[string]int
+  designs  []string
+  trie     *trieNode
 }
 
 func newInput(patterns, designs []string) *input {
-  validDesigns := make(map[string]bool)
-  arrangementCount := make(map[string]int)
-  for _, p := range patterns {
-    validDesigns[p] = true
-  }
-  return &input{patterns: patterns, designs: designs, validDesigns: validDesigns, arrangementCount: arrangementCount}
+  return &input{patterns: patterns, designs: designs, trie: newTrie(patterns)}
 }
 
 func printData(d *input) {
@@ -68,74 +107,136 @@ func readInput(path string) (*input, error) {
   return newInput(patterns, designs), nil
 }
 
+// longestPrefix marks every index of the design that towels can reach from
+// its start, the design can be made when its end is reachable
+func longestPrefix(data *input, design string) int {
+  runes := []rune(design)
+  reachable := make([]bool, len(runes)+1)
+  reachable[0] = true
+  result := 0
+  for i := range runes {
+    if !reachable[i] {
+      continue
+    }
+    for _, end := range data.trie.Matches(runes, i) {
+      reachable[end] = true
+      result = max(result, end)
+    }
+  }
+  return result
+}
+
 func checkDesign(data *input, design string) bool {
-  // Check if design is stored as valid
-  if valid, contains := data.validDesigns[design]; contains {
-    return valid
-  }
-  // Break the design into smaller chunks
-  if len(design) == 1 {
-    data.validDesigns[design] = false
-    return false
-  }
-  for _, pattern := range data.patterns {
-      if strings.HasPrefix(design, pattern) {
-          remainingDesign := design[len(pattern):]
-          if checkDesign(data, remainingDesign) {
-            data.validDesigns[remainingDesign] = true
-            return true
-          }
-          data.validDesigns[remainingDesign] = false
+  return longestPrefix(data, design) == len([]rune(design))
+}
+
+// countArrangements fills ways[i] with the number of arrangements for the
+// design from index i to its end
+func countArrangements(data *input, design string) int {
+  runes := []rune(design)
+  ways := make([]int, len(runes)+1)
+  ways[len(runes)] = 1
+  for i := len(runes) - 1; i >= 0; i-- {
+    for _, end := range data.trie.Matches(runes, i) {
+      ways[i] += ways[end]
+    }
+  }
+  return ways[0]
+}
+
+// minTowels returns the fewest towels that make the design or -1 when the
+// design can't be made
+func minTowels(data *input, design string) int {
+  runes := []rune(design)
+  towels := make([]int, len(runes)+1)
+  for i := range runes {
+    towels[i] = -1
+  }
+  for i := len(runes) - 1; i >= 0; i-- {
+    for _, end := range data.trie.Matches(runes, i) {
+      if towels[end] != -1 && (towels[i] == -1 || towels[end]+1 < towels[i]) {
+        towels[i] = towels[end] + 1
       }
+    }
   }
-  return false
+  return towels[0]
 }
 
-func countArrangements(data *input, design string) int {
-  // Check if arrangements count for design is memorized
-  if cnt, contains := data.arrangementCount[design]; contains {
-      return cnt
-  }
-  // Valid
-  if design == "" {
-      return 1
-  }
-  cnt := 0
-  for _, pattern := range data.patterns {
-      if strings.HasPrefix(design, pattern) {
-          remainingDesign := design[len(pattern):]
-          cnt += countArrangements(data, remainingDesign)
+func exampleArrangements(data *input, design string, limit int) [][]string {
+  runes := []rune(design)
+  canFinish := make([]bool, len(runes)+1)
+  canFinish[len(runes)] = true
+  for i := len(runes) - 1; i >= 0; i-- {
+    for _, end := range data.trie.Matches(runes, i) {
+      if canFinish[end] {
+        canFinish[i] = true
+        break
+      }
+    }
+  }
+  var result [][]string
+  var walk func(start int, towels []string)
+  walk = func(start int, towels []string) {
+    if len(result) >= limit {
+      return
+    }
+    if start == len(runes) {
+      result = append(result, slices.Clone(towels))
+      return
+    }
+    for _, end := range data.trie.Matches(runes, start) {
+      if canFinish[end] {
+        walk(end, append(towels, string(runes[start:end])))
       }
+    }
   }
-  data.arrangementCount[design] = cnt
-  return cnt
+  walk(0, nil)
+  return result
+}
+
+type options struct {
+  details  bool
+  examples int
 }
 
-func task1(data *input, debug bool) {
+func task1(data *input, debug bool, opts options) {
   result := 0
   for _, d := range data.designs {
     if debug {
       fmt.Printf("Testing design %s\n", string(d))
     }
-    if checkDesign(data, d) {
+    prefix := longestPrefix(data, d)
+    if prefix == len([]rune(d)) {
       result++
+      continue
+    }
+    if opts.details {
+      fmt.Printf("%s can't be made, longest prefix that can: %q\n", d, string([]rune(d)[:prefix]))
     }
   }
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data *input, debug bool) {
+func task2(data *input, debug bool, opts options) {
   result := 0
   for _, d := range data.designs {
     if debug {
       fmt.Printf("Testing design %s\n", string(d))
     }
-    result += countArrangements(data, d)
+    count := countArrangements(data, d)
+    result += count
+    if !opts.details || count == 0 {
+      continue
+    }
+    fmt.Printf("%s: %d arrangements, at least %d towels\n", d, count, minTowels(data, d))
+    for _, arrangement := range exampleArrangements(data, d, opts.examples) {
+      fmt.Printf("  %s\n", strings.Join(arrangement, ", "))
+    }
   }
   fmt.Printf("Task 2: %d\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -147,9 +248,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -162,9 +263,18 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  examples, err := util.IntArg(os.Args[1:], "--examples", 3)
+  if err != nil || examples < 0 {
+    fmt.Println("Number of examples can't be negative\nExiting!")
+    os.Exit(1)
+  }
+  opts := options{
+    details:  slices.Contains(os.Args[1:], "--details"),
+    examples: examples,
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
   "adventOfCode2024/util"
@@ -21,14 +24,30 @@ func (n *node) String() string {
   return fmt.Sprintf("%s(%d,%d)", string(n.symbol), n.x, n.y)
 }
 
-type cheat struct {
-  start *node
-  end   *node
-  cost  int
+// cheatHistogram maps the picoseconds saved by a cheat to the number of
+// cheats saving that much
+type cheatHistogram map[int]int
+
+func (h cheatHistogram) AtLeast(limit int) int {
+  result := 0
+  for saving, count := range h {
+    if saving >= limit {
+      result += count
+    }
+  }
+  return result
 }
 
-func (c *cheat) String() string {
-  return fmt.Sprintf("Cheat: %v --> %v saves %d picoseconds", c.start, c.end, c.cost)
+func (h cheatHistogram) String() string {
+  var sb strings.Builder
+  for _, saving := range slices.Sorted(maps.Keys(h)) {
+    if h[saving] == 1 {
+      fmt.Fprintf(&sb, "- There is one cheat that saves %d picoseconds.\n", saving)
+      continue
+    }
+    fmt.Fprintf(&sb, "- There are %d cheats that save %d picoseconds.\n", h[saving], saving)
+  }
+  return sb.String()
 }
 
 type queue struct {
@@ -77,19 +96,6 @@ func findStart(data [][]rune) (int, int) {
   return -1, -1
 }
 
-func containsCheat(s []*cheat, cheat *cheat) bool {
-  for _, c := range s {
-    if c.start.x != cheat.start.x || c.start.y != cheat.start.y {
-      continue
-    }
-    if c.end.x != cheat.end.x || c.end.y != cheat.end.y {
-      continue
-    }
-    return true
-  }
-  return false
-}
-
 func abs(x int) int {
   if x < 0 {
     return -x
@@ -101,59 +107,147 @@ func distance(a, b *node) int {
   return abs(a.x - b.x) + abs(a.y - b.y)
 }
 
-func findCheats(path *queue, cheatSize int, limit int, debug bool) int {
-  result := 0
-  cheats := []*cheat{}
-  originalLen := len(path.data)
-  cnt := 0
-  for len(path.data) > 0 {
-    if debug {
-      cnt++
-      fmt.Printf("%d/%d\n", cnt, originalLen)
-    }
-    currNode := path.pop()
-    for _, potentialNode := range path.data {
-      stepsTaken := distance(currNode, potentialNode)
-      if stepsTaken > cheatSize {
-        continue
-      }
-      saving := potentialNode.cost - currNode.cost - stepsTaken
-      if saving <= 0 {
+// cheatRules describe which cheats are allowed and how they are counted,
+// wallsOnly cheats have to stay inside walls until their last step and
+// countPaths counts every shortest cheat route instead of every start and
+// end pair
+type cheatRules struct {
+  radius     int
+  minSaving  int
+  wallsOnly  bool
+  countPaths bool
+}
+
+func binomial(n, k int) int {
+  result := 1
+  for i := 1; i <= k; i++ {
+    result = result * (n - k + i) / i
+  }
+  return result
+}
+
+func trackIndex(path *queue, width, height int) [][]*node {
+  index := make([][]*node, height)
+  for i := range index {
+    index[i] = make([]*node, width)
+  }
+  for _, n := range path.data {
+    index[n.x][n.y] = n
+  }
+  return index
+}
+
+// jumpCheats looks at every track cell within the cheat radius of each cell
+// on the path, cells on the track are found through the index grid so the
+// work per cell only depends on the radius
+func jumpCheats(path *queue, index [][]*node, rules cheatRules) cheatHistogram {
+  result := make(cheatHistogram)
+  for _, currNode := range path.data {
+    for dx := -rules.radius; dx <= rules.radius; dx++ {
+      newX := currNode.x + dx
+      if newX < 0 || newX >= len(index) {
         continue
       }
-      newCheat := &cheat{
-        start: currNode, 
-        end: potentialNode,
-        cost: saving,
+      remaining := rules.radius - abs(dx)
+      for dy := -remaining; dy <= remaining; dy++ {
+        newY := currNode.y + dy
+        if newY < 0 || newY >= len(index[newX]) {
+          continue
+        }
+        potentialNode := index[newX][newY]
+        if potentialNode == nil {
+          continue
+        }
+        saving := potentialNode.cost - currNode.cost - distance(currNode, potentialNode)
+        if saving <= 0 {
+          continue
+        }
+        if rules.countPaths {
+          result[saving] += binomial(abs(dx)+abs(dy), abs(dx))
+          continue
+        }
+        result[saving]++
       }
-      if containsCheat(cheats, newCheat) {
+    }
+  }
+  return result
+}
+
+// wallCheats runs a BFS through the walls around each cell on the path, a
+// cheat ends on the first track cell it steps on and its length is the
+// number of steps it took through the walls
+func wallCheats(data [][]rune, path *queue, index [][]*node, rules cheatRules) cheatHistogram {
+  result := make(cheatHistogram)
+  stamp := make([][]int, len(data))
+  dist := make([][]int, len(data))
+  ways := make([][]int, len(data))
+  for i := range data {
+    stamp[i] = make([]int, len(data[i]))
+    dist[i] = make([]int, len(data[i]))
+    ways[i] = make([]int, len(data[i]))
+  }
+  for step, currNode := range path.data {
+    // Stamps start at 1 so the zeroed grid counts as not visited
+    visit := step + 1
+    q := &queue{data: []*node{currNode}}
+    stamp[currNode.x][currNode.y] = visit
+    dist[currNode.x][currNode.y] = 0
+    ways[currNode.x][currNode.y] = 1
+    ends := []*node{}
+    for len(q.data) > 0 {
+      n := q.pop()
+      if dist[n.x][n.y] >= rules.radius {
         continue
       }
-      if newCheat.cost >= limit {
-        result++
+      for _, direction := range [][]int{{1,0}, {-1,0}, {0,1}, {0,-1}} {
+        newX := n.x + direction[0]
+        newY := n.y + direction[1]
+        if newX < 0 || newY < 0 || newX >= len(data) || newY >= len(data[newX]) {
+          continue
+        }
+        newDist := dist[n.x][n.y] + 1
+        if stamp[newX][newY] == visit {
+          if dist[newX][newY] == newDist {
+            ways[newX][newY] += ways[n.x][n.y]
+          }
+          continue
+        }
+        stamp[newX][newY] = visit
+        dist[newX][newY] = newDist
+        ways[newX][newY] = ways[n.x][n.y]
+        if data[newX][newY] == rune('#') {
+          q.push(&node{x: newX, y: newY, symbol: data[newX][newY]})
+          continue
+        }
+        ends = append(ends, index[newX][newY])
       }
-      cheats = append(cheats, newCheat)
     }
-  }
-  if debug {
-    cheatCnt := make(map[int]int)
-    for _, c := range cheats {
-      if c.cost < limit {
+    for _, end := range ends {
+      if end == nil {
         continue
       }
-      if _, ok := cheatCnt[c.cost]; !ok {
-        cheatCnt[c.cost] = 0
+      saving := end.cost - currNode.cost - dist[end.x][end.y]
+      if saving <= 0 {
+        continue
       }
-      cheatCnt[c.cost]++
-      fmt.Println(c)
-    }
-    for k,v := range cheatCnt {
-      fmt.Printf("- There are %d cheats that save %d picoseconds\n", v, k)
+      if rules.countPaths {
+        result[saving] += ways[end.x][end.y]
+        continue
+      }
+      result[saving]++
     }
   }
   return result
 }
 
+func findCheats(data [][]rune, path *queue, rules cheatRules) cheatHistogram {
+  index := trackIndex(path, len(data[0]), len(data))
+  if rules.wallsOnly {
+    return wallCheats(data, path, index, rules)
+  }
+  return jumpCheats(path, index, rules)
+}
+
 func runTrack(data [][]rune, debug bool) *queue {
   q := &queue{data: []*node{}}
   path := &queue{data: []*node{}}
@@ -208,21 +302,34 @@ func runTrack(data [][]rune, debug bool) *queue {
   return path
 }
 
-func task1(data [][]rune, debug bool) {
-  result := 0
+func countCheats(data [][]rune, rules cheatRules, debug bool) int {
   path := runTrack(data, debug)
-  result = findCheats(path, 2, 100, debug)
+  histogram := findCheats(data, path, rules)
+  if debug {
+    fmt.Print(histogram)
+  }
+  return histogram.AtLeast(rules.minSaving)
+}
+
+func task1(data [][]rune, debug bool, rules cheatRules) {
+  result := 0
+  if rules.radius == 0 {
+    rules.radius = 2
+  }
+  result = countCheats(data, rules, debug)
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data [][]rune, debug bool) {
+func task2(data [][]rune, debug bool, rules cheatRules) {
   result := 0
-  path := runTrack(data, debug)
-  result = findCheats(path, 20, 100, debug)
+  if rules.radius == 0 {
+    rules.radius = 20
+  }
+  result = countCheats(data, rules, debug)
   fmt.Printf("Task 2: %d\n", result)
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, rules cheatRules) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -234,9 +341,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, rules)
   case 2:
-    task2(data, debug)
+    task2(data, debug, rules)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -249,9 +356,21 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  radius, err1 := util.IntArg(os.Args[1:], "--radius", 0)
+  minSaving, err2 := util.IntArg(os.Args[1:], "--min-saving", 100)
+  if err := errors.Join(err1, err2); err != nil || radius < 0 || minSaving < 1 {
+    fmt.Println("Cheat radius and minimum saving have to be positive numbers\nExiting!")
+    os.Exit(1)
+  }
+  rules := cheatRules{
+    radius:     radius,
+    minSaving:  minSaving,
+    wallsOnly:  slices.Contains(os.Args[1:], "--walls-only"),
+    countPaths: slices.Contains(os.Args[1:], "--count-paths"),
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, rules)
     if err != nil {
       fmt.Println(err)
     }
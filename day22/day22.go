@@ -4,11 +4,10 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"math"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"adventOfCode2024/util"
@@ -32,15 +31,15 @@ func newBuyer(init int) *buyer {
 type secretNumber struct {
   value     int
   price     int
-  priceDiff string
+  priceDiff int
 }
 
 func newSecretNumber(value int) *secretNumber {
-  return &secretNumber{value: value, price: value%10, priceDiff: ""}
+  return &secretNumber{value: value, price: ((value%10)+10)%10, priceDiff: 0}
 }
 
 func (sn *secretNumber) String() string {
-  return fmt.Sprintf("%d: %d (%s)", sn.value, sn.price, sn.priceDiff)
+  return fmt.Sprintf("%d: %d (%d)", sn.value, sn.price, sn.priceDiff)
 }
 
 func printData(d []*buyer) {
@@ -67,135 +66,228 @@ func readInput(path string) ([]*buyer, error) {
   return data, nil
 }
 
-func (sn *secretNumber) mix(val int) {
-  sn.value = sn.value ^ val
-  sn.price = sn.value%10
+type generatorOp struct {
+  kind   string
+  amount int
 }
 
-func (sn *secretNumber) prune() {
-  sn.value = sn.value % 16777216
-  sn.price = sn.value%10
+func (op generatorOp) String() string {
+  return fmt.Sprintf("%s %d", op.kind, op.amount)
 }
 
-func (b *buyer) evolveSecret(iters int) {
-  for range iters {
-    newSecret := newSecretNumber(b.currSecret.value)
-    newSecret.mix(newSecret.value * 64)
-    newSecret.prune()
-    newSecret.mix(int(math.Floor(float64(newSecret.value)/float64(32))))
-    newSecret.prune()
-    newSecret.mix(newSecret.value * 2048)
-    newSecret.prune()
-    newSecret.priceDiff = strconv.Itoa(newSecret.price - b.currSecret.price)
-    b.currSecret = newSecret
-    b.secrets = append(b.secrets, newSecret)
+// generator describes how a secret number evolves, every step applies the
+// ops in order: xorshl and xorshr mix the shifted secret into the secret and
+// mod prunes it
+type generator struct {
+  ops        []generatorOp
+  iterations int
+}
+
+func defaultGenerator() *generator {
+  return &generator{
+    ops: []generatorOp{
+      {kind: "xorshl", amount: 6},
+      {kind: "mod", amount: 16777216},
+      {kind: "xorshr", amount: 5},
+      {kind: "mod", amount: 16777216},
+      {kind: "xorshl", amount: 11},
+      {kind: "mod", amount: 16777216},
+    },
+    iterations: 2000,
   }
 }
 
-func containsSeq(s []*diffSequence, seq *diffSequence) bool {
-  for _, el := range s {
-    if el.sequence[0] == seq.sequence[0] && 
-    el.sequence[1] == seq.sequence[1] &&
-    el.sequence[2] == seq.sequence[2] &&
-    el.sequence[3] == seq.sequence[3] {
-      return true
+// readGenerator loads a generator from a file with one op per line, a line
+// "iterations N" sets the number of steps and lines starting with # are
+// skipped
+func readGenerator(path string) (*generator, error) {
+  g := &generator{iterations: 2000}
+  file, err := os.Open(path)
+  defer file.Close()
+  if err != nil {
+    return nil, err
+  }
+  scanner := bufio.NewScanner(file)
+  lineNumber := 0
+  for scanner.Scan() {
+    lineNumber++
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    fields := strings.Fields(line)
+    if len(fields) != 2 {
+      return nil, fmt.Errorf("Line %d: expected an op and an amount, got %q", lineNumber, line)
+    }
+    amount, err := strconv.Atoi(fields[1])
+    if err != nil {
+      return nil, fmt.Errorf("Line %d: invalid amount %q", lineNumber, fields[1])
+    }
+    switch fields[0] {
+    case "iterations":
+      if amount < 0 {
+        return nil, fmt.Errorf("Line %d: number of iterations can't be negative", lineNumber)
+      }
+      g.iterations = amount
+    case "xorshl", "xorshr":
+      if amount < 0 || amount > 62 {
+        return nil, fmt.Errorf("Line %d: shift has to be between 0 and 62", lineNumber)
+      }
+      g.ops = append(g.ops, generatorOp{kind: fields[0], amount: amount})
+    case "mod":
+      if amount < 1 {
+        return nil, fmt.Errorf("Line %d: modulus has to be positive", lineNumber)
+      }
+      g.ops = append(g.ops, generatorOp{kind: fields[0], amount: amount})
+    default:
+      return nil, fmt.Errorf("Line %d: unknown op %q, please use xorshl, xorshr, mod or iterations", lineNumber, fields[0])
     }
   }
-  return false
+  if len(g.ops) == 0 {
+    return nil, errors.New("Generator has no ops")
+  }
+  // A left shift can carry bits into the sign bit, ending with mod brings
+  // every secret back to a number that isn't negative
+  if g.ops[len(g.ops)-1].kind != "mod" {
+    return nil, errors.New("Generator has to end with a mod op so secrets can't go negative")
+  }
+  return g, nil
 }
 
-func rateSequence(data []*buyer, seqTarget string) int {
-  result := 0
-  for i := range data {
-    for j := 3; j < len(data[i].secrets); j++ {
-      seq := strings.Join([]string{
-        data[i].secrets[j-3].priceDiff,
-        data[i].secrets[j-2].priceDiff,
-        data[i].secrets[j-1].priceDiff,
-        data[i].secrets[j].priceDiff,
-      }, ",")
-      if seqTarget != seq {
-        continue
-      }
-      result += data[i].secrets[j].price
-      break
+func (g *generator) Next(value int) int {
+  for _, op := range g.ops {
+    switch op.kind {
+    case "xorshl":
+      value ^= value << op.amount
+    case "xorshr":
+      value ^= value >> op.amount
+    case "mod":
+      value = (value%op.amount + op.amount) % op.amount
     }
   }
-  return result
+  return value
 }
 
-func checkExistance(data []*buyer, seqTarget string, seqLen int) bool {
-  for i := range data {
-    for j := seqLen-1; j < len(data[i].secrets); j++ {
-      seq := make([]string, seqLen)
-      ki := 0
-      for k := seqLen-1; k > -1; k-- {
-        seq[ki] = data[i].secrets[j-k].priceDiff
-        ki++
+// NextBatch applies one step to every value, each op runs over the whole
+// slice before the next one so the inner loops stay simple
+func (g *generator) NextBatch(values []int) {
+  for _, op := range g.ops {
+    switch op.kind {
+    case "xorshl":
+      for i := range values {
+        values[i] ^= values[i] << op.amount
       }
-      seqStr := strings.Join(seq, ",")
-      if seqTarget == seqStr {
-        return true
+    case "xorshr":
+      for i := range values {
+        values[i] ^= values[i] >> op.amount
+      }
+    case "mod":
+      for i := range values {
+        values[i] = (values[i]%op.amount + op.amount) % op.amount
       }
     }
   }
-  return false
+}
 
+// Check compares the generator with the secrets from the puzzle example
+// that follow the secret 123
+func (g *generator) Check() error {
+  reference := []int{15887950, 16495136, 527345, 704524, 1553684, 12683156, 11100544, 12249484, 7753432, 5908254}
+  value := 123
+  for i, expected := range reference {
+    value = g.Next(value)
+    if value != expected {
+      return fmt.Errorf("Secret %d after 123 is %d, expected %d", i+1, value, expected)
+    }
+  }
+  return nil
 }
 
-func subFucntion(data []*buyer, seq string, wg *sync.WaitGroup, ch chan<- string) {
-  defer wg.Done()
-  ch <- fmt.Sprintf("%s %d", seq, rateSequence(data, seq))
+func (b *buyer) addSecret(value int) {
+  newSecret := newSecretNumber(value)
+  newSecret.priceDiff = newSecret.price - b.currSecret.price
+  b.currSecret = newSecret
+  b.secrets = append(b.secrets, newSecret)
 }
 
-func rateDiffSequences(data []*buyer, debug bool) int {
-  maxPrice := -1
-  var wg sync.WaitGroup
-  ch := make(chan string, 19*19*19*19)
-  for a := 9; a > -10; a-- {
-    if !checkExistance(data, fmt.Sprintf("%d", a), 1) {
-      fmt.Printf("%12s doesn't exist\n", fmt.Sprintf("%d", a))
-      continue
+func (b *buyer) evolveSecret(g *generator) {
+  for range g.iterations {
+    b.addSecret(g.Next(b.currSecret.value))
+  }
+}
+
+func evolveSecrets(data []*buyer, g *generator, batch bool) {
+  if !batch {
+    for _, d := range data {
+      d.evolveSecret(g)
     }
-    for b := 9; b > -10; b-- {
-      if !checkExistance(data, fmt.Sprintf("%d,%d", b,a), 2) {
-        fmt.Printf("%12s doesn't exist\n", fmt.Sprintf("%d,%d", b, a))
-        continue
+    return
+  }
+  values := make([]int, len(data))
+  for i, d := range data {
+    values[i] = d.currSecret.value
+  }
+  for range g.iterations {
+    g.NextBatch(values)
+    for i, d := range data {
+      d.addSecret(values[i])
+    }
+  }
+}
+
+// A window of four price differences, each between -9 and 9, is encoded as
+// a base 19 number so every possible sequence has its own slot in an array
+const (
+  diffBase      = 19
+  sequenceCount = diffBase * diffBase * diffBase * diffBase
+)
+
+func decodeSequence(key int) []int {
+  sequence := make([]int, 4)
+  for i := 3; i >= 0; i-- {
+    sequence[i] = key%diffBase - 9
+    key /= diffBase
+  }
+  return sequence
+}
+
+// bestSequence goes over every buyer once, the first time a buyer sees a
+// sequence its price is added to the total of that sequence
+func bestSequence(data []*buyer) (*diffSequence, error) {
+  totals := make([]int, sequenceCount)
+  seenBy := make([]int, sequenceCount)
+  for i, b := range data {
+    key := 0
+    for j := 1; j < len(b.secrets); j++ {
+      if diff := b.secrets[j].priceDiff; diff < -9 || diff > 9 {
+        return nil, fmt.Errorf("Price difference %d of buyer %d is not between -9 and 9", diff, i+1)
       }
-      for c := 9; c > -10; c-- {
-        if !checkExistance(data, fmt.Sprintf("%d,%d,%d", c,b,a), 3) {
-          fmt.Printf("%12s doesn't exist\n", fmt.Sprintf("%d,%d,%d", c, b, a))
-          continue
-        }
-        for d := 9; d > -10; d-- {
-          wg.Add(1)
-          seq := fmt.Sprintf("%d,%d,%d,%d", d,c,b,a)
-          if debug {
-            fmt.Printf("Checking %12s\n", seq)
-          }
-          go subFucntion(data, seq, &wg, ch)
-        }
+      key = (key*diffBase + b.secrets[j].priceDiff + 9) % sequenceCount
+      if j < 4 || seenBy[key] == i+1 {
+        continue
       }
+      seenBy[key] = i + 1
+      totals[key] += b.secrets[j].price
     }
   }
-  go func() {
-    wg.Wait()
-    close(ch)
-  }()
-  for msg := range ch {
-    msgSplit := strings.Split(msg, " ")
-    seqPrice, _ := strconv.Atoi(msgSplit[1])
-    if seqPrice > maxPrice {
-      maxPrice = seqPrice
+  best := 0
+  for key, total := range totals {
+    if total > totals[best] {
+      best = key
     }
   }
-  return maxPrice
+  return &diffSequence{price: totals[best], sequence: decodeSequence(best)}, nil
+}
+
+type options struct {
+  generator *generator
+  batch     bool
 }
 
-func task1(data []*buyer, debug bool) {
+func task1(data []*buyer, debug bool, opts options) {
   result := 0
+  evolveSecrets(data, opts.generator, opts.batch)
   for _, d := range data {
-    d.evolveSecret(2000)
     result += d.currSecret.value
     if debug {
       fmt.Printf("%v --(%d iters)--> %v\n", d.secrets[0], len(d.secrets)-1, d.currSecret)
@@ -204,16 +296,20 @@ func task1(data []*buyer, debug bool) {
   fmt.Printf("Task 1: %d\n", result)
 }
 
-func task2(data []*buyer, debug bool) {
+func task2(data []*buyer, debug bool, opts options) error {
   result := 0
-  for _, d := range data {
-    d.evolveSecret(2000)
+  evolveSecrets(data, opts.generator, opts.batch)
+  best, err := bestSequence(data)
+  if err != nil {
+    return err
   }
-  result = rateDiffSequences(data, debug)
+  result = best.price
+  fmt.Printf("Best sequence: %v\n", best.sequence)
   fmt.Printf("Task 2: %d\n", result)
+  return nil
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -225,13 +321,13 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    err = task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
-  return nil
+  return err
 }
 
 func main() {
@@ -240,9 +336,31 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  opts := options{
+    generator: defaultGenerator(),
+    batch:     slices.Contains(os.Args[1:], "--batch"),
+  }
+  if generatorPath, ok := util.ArgValue(os.Args[1:], "--generator"); ok {
+    opts.generator, err = readGenerator(generatorPath)
+    if err != nil {
+      fmt.Printf("%v\nExiting!\n", err)
+      os.Exit(1)
+    }
+  }
+  if debug {
+    fmt.Printf("Generator: %v, %d iterations\n", opts.generator.ops, opts.generator.iterations)
+  }
+  if slices.Contains(os.Args[1:], "--check") {
+    err := opts.generator.Check()
+    if err != nil {
+      fmt.Printf("Generator check failed: %v\nExiting!\n", err)
+      os.Exit(1)
+    }
+    fmt.Println("Generator matches the puzzle example")
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"math/bits"
 	"os"
 	"slices"
 	"strings"
@@ -13,52 +14,279 @@ import (
 	"adventOfCode2024/util"
 )
 
-type set struct {
-  data []string
+type bitset []uint64
+
+func newBitset(size int) bitset {
+  return make(bitset, (size+63)/64)
+}
+
+func (b bitset) Set(i int) {
+  b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) Clear(i int) {
+  b[i/64] &^= 1 << (i % 64)
+}
+
+func (b bitset) Has(i int) bool {
+  return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b bitset) And(b2 bitset) bitset {
+  result := make(bitset, len(b))
+  for i := range b {
+    result[i] = b[i] & b2[i]
+  }
+  return result
 }
 
-func newSet(data  []string) *set {
-  return &set{data: data}
+func (b bitset) AndNot(b2 bitset) bitset {
+  result := make(bitset, len(b))
+  for i := range b {
+    result[i] = b[i] &^ b2[i]
+  }
+  return result
 }
 
-func (s *set) Append(el string) bool {
-  for _, d := range s.data {
-    if d == el {
+func (b bitset) Count() int {
+  result := 0
+  for _, w := range b {
+    result += bits.OnesCount64(w)
+  }
+  return result
+}
+
+func (b bitset) IsEmpty() bool {
+  for _, w := range b {
+    if w != 0 {
       return false
     }
   }
-  s.data = append(s.data, el)
-  slices.Sort(s.data)
   return true
 }
 
-func (s *set) Contains(el string) bool {
-  for _, d := range s.data {
-    if d == el {
-      return true
+func (b bitset) Members() []int {
+  var result []int
+  for i, w := range b {
+    for w != 0 {
+      result = append(result, i*64+bits.TrailingZeros64(w))
+      w &= w - 1
     }
   }
-  return false
+  return result
 }
 
-func (s *set) Equals(s2 *set) bool {
-  if len(s.data) != len(s2.data) {
-    return false
+// graph keeps the computers sorted by name, computer i is connected to
+// every computer in adj[i]
+type graph struct {
+  names []string
+  index map[string]int
+  adj   []bitset
+}
+
+func newGraph(connectionMap map[string][]string) *graph {
+  names := slices.Sorted(maps.Keys(connectionMap))
+  g := &graph{names: names, index: make(map[string]int, len(names)), adj: make([]bitset, len(names))}
+  for i, name := range names {
+    g.index[name] = i
+    g.adj[i] = newBitset(len(names))
   }
-  for i := range s.data {
-    if s.data[i] != s2.data[i] {
-      return false
+  for pc, conns := range connectionMap {
+    for _, conn := range conns {
+      g.adj[g.index[pc]].Set(g.index[conn])
     }
   }
-  return true
+  return g
+}
+
+func (g *graph) Names(ids []int) []string {
+  result := make([]string, len(ids))
+  for i, id := range ids {
+    result[i] = g.names[id]
+  }
+  slices.Sort(result)
+  return result
+}
+
+// Triangles lists every triangle once as u < v < w by only looking at the
+// common neighbours of an edge that come after both of its ends
+func (g *graph) Triangles() [][3]int {
+  var result [][3]int
+  for u := range g.names {
+    for _, v := range g.adj[u].Members() {
+      if v <= u {
+        continue
+      }
+      for _, w := range g.adj[u].And(g.adj[v]).Members() {
+        if w > v {
+          result = append(result, [3]int{u, v, w})
+        }
+      }
+    }
+  }
+  return result
+}
+
+// degeneracyOrder repeatedly removes the computer with the fewest remaining
+// connections, every computer then has few neighbours later in the order
+func (g *graph) degeneracyOrder() []int {
+  degree := make([]int, len(g.names))
+  removed := make([]bool, len(g.names))
+  for i := range g.names {
+    degree[i] = g.adj[i].Count()
+  }
+  order := make([]int, 0, len(g.names))
+  for range g.names {
+    next := -1
+    for i := range g.names {
+      if !removed[i] && (next == -1 || degree[i] < degree[next]) {
+        next = i
+      }
+    }
+    removed[next] = true
+    order = append(order, next)
+    for _, n := range g.adj[next].Members() {
+      degree[n]--
+    }
+  }
+  return order
+}
+
+func (g *graph) bronKerbosch(r []int, p, x bitset, report func(clique []int)) {
+  if p.IsEmpty() {
+    if x.IsEmpty() {
+      report(slices.Clone(r))
+    }
+    return
+  }
+  pivot, pivotCount := -1, -1
+  for _, u := range append(p.Members(), x.Members()...) {
+    count := p.And(g.adj[u]).Count()
+    if count > pivotCount {
+      pivot, pivotCount = u, count
+    }
+  }
+  for _, v := range p.AndNot(g.adj[pivot]).Members() {
+    g.bronKerbosch(append(r, v), p.And(g.adj[v]), x.And(g.adj[v]), report)
+    p.Clear(v)
+    x.Set(v)
+  }
+}
+
+// MaximalCliques calls report for every maximal clique, the outer level goes
+// over the computers in degeneracy order and the rest is Bron-Kerbosch with
+// pivoting
+func (g *graph) MaximalCliques(report func(clique []int)) {
+  p := newBitset(len(g.names))
+  for i := range g.names {
+    p.Set(i)
+  }
+  x := newBitset(len(g.names))
+  for _, v := range g.degeneracyOrder() {
+    g.bronKerbosch([]int{v}, p.And(g.adj[v]), x.And(g.adj[v]), report)
+    p.Clear(v)
+    x.Set(v)
+  }
 }
 
-func (s *set) Len() int {
-  return len(s.data)
+func (g *graph) MaximumClique() []string {
+  var best []int
+  g.MaximalCliques(func(clique []int) {
+    if len(clique) > len(best) {
+      best = clique
+    }
+  })
+  return g.Names(best)
 }
 
-func (s *set) String() string {
-  return strings.Join(s.data, ",")
+func (g *graph) Components() [][]int {
+  var result [][]int
+  seen := newBitset(len(g.names))
+  for start := range g.names {
+    if seen.Has(start) {
+      continue
+    }
+    seen.Set(start)
+    component := []int{start}
+    for i := 0; i < len(component); i++ {
+      for _, n := range g.adj[component[i]].Members() {
+        if seen.Has(n) {
+          continue
+        }
+        seen.Set(n)
+        component = append(component, n)
+      }
+    }
+    result = append(result, component)
+  }
+  slices.SortFunc(result, func(c1, c2 []int) int {
+    return len(c2) - len(c1)
+  })
+  return result
+}
+
+// CoreNumbers gives every computer the largest k for which it belongs to a
+// k-core, a subgraph where every computer has at least k connections
+func (g *graph) CoreNumbers() []int {
+  degree := make([]int, len(g.names))
+  for i := range g.names {
+    degree[i] = g.adj[i].Count()
+  }
+  core := make([]int, len(g.names))
+  removed := make([]bool, len(g.names))
+  k := 0
+  for range g.names {
+    next := -1
+    for i := range g.names {
+      if !removed[i] && (next == -1 || degree[i] < degree[next]) {
+        next = i
+      }
+    }
+    k = max(k, degree[next])
+    core[next] = k
+    removed[next] = true
+    for _, n := range g.adj[next].Members() {
+      if !removed[n] {
+        degree[n]--
+      }
+    }
+  }
+  return core
+}
+
+func (g *graph) TrianglesOf(v int) [][3]int {
+  var result [][3]int
+  for _, u := range g.adj[v].Members() {
+    for _, w := range g.adj[v].And(g.adj[u]).Members() {
+      if w > u {
+        result = append(result, [3]int{v, u, w})
+      }
+    }
+  }
+  return result
+}
+
+func (g *graph) WriteDOT(path string, highlight []string) error {
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  w := bufio.NewWriter(file)
+  fmt.Fprintln(w, "graph lan {")
+  fmt.Fprintln(w, "  node [shape=circle, fontname=monospace];")
+  for _, name := range highlight {
+    fmt.Fprintf(w, "  \"%s\" [color=crimson, style=filled, fillcolor=mistyrose];\n", name)
+  }
+  for u := range g.names {
+    for _, v := range g.adj[u].Members() {
+      if v > u {
+        fmt.Fprintf(w, "  \"%s\" -- \"%s\";\n", g.names[u], g.names[v])
+      }
+    }
+  }
+  fmt.Fprintln(w, "}")
+  return w.Flush()
 }
 
 func printData(d [][]string) {
@@ -103,102 +331,194 @@ func getConnectionMap(data [][]string) map[string][]string {
   return result
 }
 
-func containsSet(slice []*set, s *set) bool {
-  for _, el := range slice {
-    if el.Equals(s) {
-      return true
+func task1(data [][]string, debug bool, opts options) {
+  result := 0
+  connectionMap := getConnectionMap(data)
+  if debug {
+    fmt.Println("Connection map:")
+    printConnectionMap(connectionMap)
+  }
+  g := newGraph(connectionMap)
+  if debug {
+    fmt.Println("Connection sets:")
+  }
+  for _, t := range g.Triangles() {
+    names := g.Names(t[:])
+    if debug {
+      fmt.Println(strings.Join(names, ","))
+    }
+    for _, name := range names {
+      if strings.HasPrefix(name, opts.prefix) {
+        result++
+        break
+      }
     }
   }
-  return false
+  fmt.Printf("Task 1: %d\n", result)
 }
 
-func getLanParty(connectionMap map[string][]string, oldSet *set, currPC string, limit int) *set {
-  if limit != -1 && oldSet.Len() == limit {
-    return oldSet
+func exportSVG(data [][]string, connectionMap map[string][]string, lanParty []string) error {
+  path, err := util.OutputsPath("day23.svg")
+  if err != nil {
+    return err
   }
-  for _, oldPc := range oldSet.data {
-    if !slices.Contains(connectionMap[currPC], oldPc) {
-      return oldSet
-    }
+  nodes := slices.Sorted(maps.Keys(connectionMap))
+  edges := make([][2]string, len(data))
+  for i, conn := range data {
+    edges[i] = [2]string{conn[0], conn[1]}
   }
-  newSet := oldSet
-  newSet.Append(currPC)
-  bestSet := newSet
-  for _, potentialPC := range connectionMap[currPC] {
-    if newSet.Contains(potentialPC) {
-      continue
-    }
-    potentialSet := getLanParty(connectionMap, newSet, potentialPC, limit)
-    if potentialSet.Len() > bestSet.Len() {
-      bestSet = potentialSet
-    }
+  err = util.WriteGraphSVG(path, nodes, edges, lanParty)
+  if err != nil {
+    return err
   }
-  return bestSet
+  fmt.Printf("Network written to: %s\n", path)
+  return nil
 }
 
-func getConnectionSets(data [][]string, debug bool) []*set {
+func task2(data [][]string, debug bool, opts options) {
+  result := ""
   connectionMap := getConnectionMap(data)
   if debug {
     fmt.Println("Connection map:")
     printConnectionMap(connectionMap)
   }
-  result := []*set{}
-  for pc1 := range maps.Keys(connectionMap) {
-    for _, pc2 := range connectionMap[pc1] {
-      for _, pc3 := range connectionMap[pc2] {
-        if !slices.Contains(connectionMap[pc3], pc1) {
-          continue
-        }
-        s := newSet([]string{pc1, pc2, pc3})
-        if containsSet(result, s) {
-          continue
-        }
-        result = append(result, s)
+  g := newGraph(connectionMap)
+  if opts.minClique > 0 {
+    var cliques [][]string
+    g.MaximalCliques(func(clique []int) {
+      if len(clique) >= opts.minClique {
+        cliques = append(cliques, g.Names(clique))
       }
+    })
+    slices.SortFunc(cliques, func(c1, c2 []string) int {
+      if len(c1) != len(c2) {
+        return len(c2) - len(c1)
+      }
+      return slices.Compare(c1, c2)
+    })
+    fmt.Printf("Maximal cliques with at least %d computers:\n", opts.minClique)
+    for _, c := range cliques {
+      fmt.Printf("%d: %s\n", len(c), strings.Join(c, ","))
     }
   }
-  return result
+  lanParty := g.MaximumClique()
+  result = strings.Join(lanParty, ",")
+  if opts.svg {
+    err := exportSVG(data, connectionMap, lanParty)
+    if err != nil {
+      fmt.Println(err)
+    }
+  }
+  fmt.Printf("Task 2: %s\n", result)
 }
 
-func task1(data [][]string, debug bool) {
-  result := 0
-  connectionSets := getConnectionSets(data, debug)
-  if debug {
-    fmt.Println("Connection sets:")
-  }
-  for _, s := range connectionSets {
-    if debug {
-      fmt.Println(s)
-    }
-    for _, si := range s.data {
-      if strings.HasPrefix(si, "t") {
-        result++
-        break
-      }
+type options struct {
+  svg       bool
+  minClique int
+  prefix    string
+}
+
+func hasPrefix(names []string, prefix string) bool {
+  for _, name := range names {
+    if strings.HasPrefix(name, prefix) {
+      return true
     }
   }
-  fmt.Printf("Task 1: %d\n", result)
+  return false
 }
 
-func task2(data [][]string, debug bool) {
-  result := ""
+// RunCommand answers one of the network queries instead of the puzzle
+// tasks, args are the arguments that follow the command name
+func RunCommand(path string, command string, args []string, debug bool, opts options) error {
+  data, err := readInput(path)
+  if err != nil {
+    return err
+  }
   connectionMap := getConnectionMap(data)
   if debug {
     fmt.Println("Connection map:")
     printConnectionMap(connectionMap)
   }
-  besSet := newSet([]string{})
-  for k := range connectionMap {
-    potentialSet := getLanParty(connectionMap, newSet([]string{}), k, -1)
-    if potentialSet.Len() > besSet.Len() {
-      besSet = potentialSet
+  g := newGraph(connectionMap)
+  switch command {
+  case "components":
+    components := g.Components()
+    fmt.Printf("%d connected components\n", len(components))
+    for _, c := range components {
+      fmt.Printf("%d: %s\n", len(c), strings.Join(g.Names(c), ","))
+    }
+  case "degrees":
+    counter := make(map[int]int)
+    for i := range g.names {
+      counter[g.adj[i].Count()]++
+    }
+    fmt.Println("Degree distribution:")
+    for _, degree := range slices.Sorted(maps.Keys(counter)) {
+      fmt.Printf("%d connections: %d computers\n", degree, counter[degree])
+    }
+  case "kcore":
+    core := g.CoreNumbers()
+    if len(core) == 0 {
+      return errors.New("No computers in the network")
+    }
+    cores := make(map[int][]int)
+    for i, k := range core {
+      cores[k] = append(cores[k], i)
+    }
+    for _, k := range slices.Sorted(maps.Keys(cores)) {
+      fmt.Printf("Core number %d: %d computers\n", k, len(cores[k]))
+    }
+    maxCore := slices.Max(core)
+    fmt.Printf("Computers in the %d-core: %s\n", maxCore, strings.Join(g.Names(cores[maxCore]), ","))
+  case "triangles":
+    if len(args) == 0 || strings.HasPrefix(args[0], "--") {
+      return errors.New("Command triangles needs a computer name")
     }
+    v, ok := g.index[args[0]]
+    if !ok {
+      return fmt.Errorf("Unknown computer: %s", args[0])
+    }
+    triangles := g.TrianglesOf(v)
+    fmt.Printf("%d triangles contain %s\n", len(triangles), args[0])
+    for _, t := range triangles {
+      fmt.Println(strings.Join(g.Names(t[:]), ","))
+    }
+  case "cliques":
+    minClique := max(opts.minClique, 3)
+    var cliques [][]string
+    g.MaximalCliques(func(clique []int) {
+      names := g.Names(clique)
+      if len(clique) >= minClique && hasPrefix(names, opts.prefix) {
+        cliques = append(cliques, names)
+      }
+    })
+    slices.SortFunc(cliques, func(c1, c2 []string) int {
+      if len(c1) != len(c2) {
+        return len(c2) - len(c1)
+      }
+      return slices.Compare(c1, c2)
+    })
+    fmt.Printf("%d maximal cliques with at least %d computers and a name starting with %q\n", len(cliques), minClique, opts.prefix)
+    for _, c := range cliques {
+      fmt.Printf("%d: %s\n", len(c), strings.Join(c, ","))
+    }
+  case "dot":
+    outPath, err := util.OutputsPath("day23.dot")
+    if err != nil {
+      return err
+    }
+    err = g.WriteDOT(outPath, g.MaximumClique())
+    if err != nil {
+      return err
+    }
+    fmt.Printf("Network written to: %s\n", outPath)
+  default:
+    return fmt.Errorf("Unknown command %s, please use components, degrees, kcore, triangles, cliques or dot", command)
   }
-  result = strings.Join(besSet.data, ",")
-  fmt.Printf("Task 2: %s\n", result)
+  return nil
 }
 
-func Run(path string, taskId int, debug bool) error {
+func Run(path string, taskId int, debug bool, opts options) error {
   data, err := readInput(path)
   if err != nil {
     return err
@@ -210,9 +530,9 @@ func Run(path string, taskId int, debug bool) error {
   }
   switch taskId {
   case 1:
-    task1(data, debug)
+    task1(data, debug, opts)
   case 2:
-    task2(data, debug)
+    task2(data, debug, opts)
   default:
     return errors.New("Invalid value for taskId, please use 1 or 2")
   }
@@ -225,9 +545,32 @@ func main() {
     fmt.Printf("%v\nExiting!\n", err)
     os.Exit(1)
   }
+  minClique, err := util.IntArg(os.Args[1:], "--min-clique", 0)
+  if err != nil || minClique < 0 {
+    fmt.Println("Minimum clique size can't be negative\nExiting!")
+    os.Exit(1)
+  }
+  prefix, ok := util.ArgValue(os.Args[1:], "--prefix")
+  if !ok {
+    prefix = "t"
+  }
+  opts := options{
+    svg:       slices.Contains(os.Args[1:], "--svg"),
+    minClique: minClique,
+    prefix:    prefix,
+  }
+  if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "--") {
+    tStart := time.Now()
+    err := RunCommand(path, os.Args[1], os.Args[2:], debug, opts)
+    if err != nil {
+      fmt.Println(err)
+    }
+    fmt.Printf("Command %s execution time: %v\n", os.Args[1], time.Since(tStart))
+    return
+  }
   for taskId := 1; taskId <= 2; taskId++ {
     tStart := time.Now()
-    err := Run(path, taskId, debug)
+    err := Run(path, taskId, debug, opts)
     if err != nil {
       fmt.Println(err)
     }
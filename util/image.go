@@ -0,0 +1,95 @@
+package util
+
+import (
+  "errors"
+  "image"
+  "image/color"
+  "image/gif"
+  "image/png"
+  "os"
+  "slices"
+)
+
+// Palette maps grid cells to the colour they are drawn with, cells missing
+// from the palette are drawn black
+type Palette map[rune]color.Color
+
+func (p Palette) colors() ([]rune, color.Palette, error) {
+  if len(p) > 255 {
+    return nil, nil, errors.New("Palette can't have more than 255 colours")
+  }
+  cells := []rune{}
+  for c := range p {
+    cells = append(cells, c)
+  }
+  slices.Sort(cells)
+  colors := color.Palette{color.Black}
+  for _, c := range cells {
+    colors = append(colors, p[c])
+  }
+  return cells, colors, nil
+}
+
+func gridImage(grid [][]rune, cells []rune, colors color.Palette, scale int) *image.Paletted {
+  width := 0
+  for i := range grid {
+    width = max(width, len(grid[i]))
+  }
+  img := image.NewPaletted(image.Rect(0, 0, width*scale, len(grid)*scale), colors)
+  for i := range grid {
+    for j := range grid[i] {
+      idx, found := slices.BinarySearch(cells, grid[i][j])
+      if !found {
+        continue
+      }
+      for dy := range scale {
+        for dx := range scale {
+          img.SetColorIndex(j*scale+dx, i*scale+dy, uint8(idx+1))
+        }
+      }
+    }
+  }
+  return img
+}
+
+func WritePNG(path string, grid [][]rune, palette Palette, scale int) error {
+  if scale < 1 {
+    return errors.New("Image scale has to be at least 1")
+  }
+  cells, colors, err := palette.colors()
+  if err != nil {
+    return err
+  }
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  return png.Encode(file, gridImage(grid, cells, colors, scale))
+}
+
+// WriteGIF writes every frame as one image of an animated GIF, delay is the
+// time between frames in 100ths of a second
+func WriteGIF(path string, frames [][][]rune, palette Palette, scale int, delay int) error {
+  if scale < 1 {
+    return errors.New("Image scale has to be at least 1")
+  }
+  if len(frames) == 0 {
+    return errors.New("No frames to write")
+  }
+  cells, colors, err := palette.colors()
+  if err != nil {
+    return err
+  }
+  anim := &gif.GIF{}
+  for _, frame := range frames {
+    anim.Image = append(anim.Image, gridImage(frame, cells, colors, scale))
+    anim.Delay = append(anim.Delay, delay)
+  }
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  return gif.EncodeAll(file, anim)
+}
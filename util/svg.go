@@ -0,0 +1,172 @@
+package util
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "html"
+  "image/color"
+  "math"
+  "os"
+  "slices"
+  "strings"
+)
+
+type GridPoint struct {
+  Row int
+  Col int
+}
+
+var pathColors = []string{"#ffd700", "#ff4500", "#1e90ff", "#32cd32", "#ff69b4", "#00ced1"}
+
+func hexColor(c color.Color) string {
+  r, g, b, _ := c.RGBA()
+  return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func svgHeader(w *bufio.Writer, width, height int) {
+  fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+}
+
+// WriteGridSVG draws the grid as cellSize squares and every path as a
+// polyline through the centres of its cells
+func WriteGridSVG(path string, grid [][]rune, palette Palette, paths [][]GridPoint, cellSize int) error {
+  if cellSize < 1 {
+    return errors.New("Cell size has to be at least 1")
+  }
+  width := 0
+  for i := range grid {
+    width = max(width, len(grid[i]))
+  }
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  w := bufio.NewWriter(file)
+  svgHeader(w, width*cellSize, len(grid)*cellSize)
+  fmt.Fprintf(w, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(color.Black))
+  for i := range grid {
+    for j := range grid[i] {
+      c, ok := palette[grid[i][j]]
+      if !ok {
+        continue
+      }
+      fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", j*cellSize, i*cellSize, cellSize, cellSize, hexColor(c))
+    }
+  }
+  for idx, p := range paths {
+    points := make([]string, len(p))
+    for i, gp := range p {
+      points[i] = fmt.Sprintf("%d,%d", gp.Col*cellSize+cellSize/2, gp.Row*cellSize+cellSize/2)
+    }
+    fmt.Fprintf(w, "<polyline points=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"%d\" stroke-linejoin=\"round\" stroke-opacity=\"0.8\"/>\n", strings.Join(points, " "), pathColors[idx%len(pathColors)], max(1, cellSize/3))
+  }
+  fmt.Fprintln(w, "</svg>")
+  return w.Flush()
+}
+
+type vector struct {
+  x float64
+  y float64
+}
+
+// forceLayout places the nodes with the Fruchterman-Reingold algorithm,
+// starting from a circle so the result is the same on every run
+func forceLayout(nodes []string, edges [][2]string, size float64, iterations int) map[string]vector {
+  index := make(map[string]int, len(nodes))
+  pos := make([]vector, len(nodes))
+  for i, n := range nodes {
+    index[n] = i
+    angle := 2 * math.Pi * float64(i) / float64(len(nodes))
+    pos[i] = vector{x: size/2 + size/3*math.Cos(angle), y: size/2 + size/3*math.Sin(angle)}
+  }
+  k := math.Sqrt(size * size / float64(len(nodes)))
+  temperature := size / 10
+  disp := make([]vector, len(nodes))
+  for it := range iterations {
+    clear(disp)
+    for i := range pos {
+      for j := i + 1; j < len(pos); j++ {
+        dx := pos[i].x - pos[j].x
+        dy := pos[i].y - pos[j].y
+        dist := max(0.01, math.Hypot(dx, dy))
+        force := k * k / dist / dist
+        disp[i].x += dx * force
+        disp[i].y += dy * force
+        disp[j].x -= dx * force
+        disp[j].y -= dy * force
+      }
+    }
+    for _, e := range edges {
+      i, j := index[e[0]], index[e[1]]
+      dx := pos[i].x - pos[j].x
+      dy := pos[i].y - pos[j].y
+      force := math.Hypot(dx, dy) / k
+      disp[i].x -= dx * force
+      disp[i].y -= dy * force
+      disp[j].x += dx * force
+      disp[j].y += dy * force
+    }
+    t := temperature * (1 - float64(it)/float64(iterations))
+    for i := range pos {
+      length := max(0.01, math.Hypot(disp[i].x, disp[i].y))
+      step := min(length, t)
+      pos[i].x = min(size, max(0, pos[i].x+disp[i].x/length*step))
+      pos[i].y = min(size, max(0, pos[i].y+disp[i].y/length*step))
+    }
+  }
+  result := make(map[string]vector, len(nodes))
+  for i, n := range nodes {
+    result[n] = pos[i]
+  }
+  return result
+}
+
+// WriteGraphSVG draws an undirected graph with a force-directed layout,
+// highlighted nodes and the edges between them are drawn in red
+func WriteGraphSVG(path string, nodes []string, edges [][2]string, highlight []string) error {
+  if len(nodes) == 0 {
+    return errors.New("No nodes to draw")
+  }
+  size := max(400, 60*math.Sqrt(float64(len(nodes))))
+  pos := forceLayout(nodes, edges, size, 300)
+  margin := 20.0
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  w := bufio.NewWriter(file)
+  canvas := int(size + 2*margin)
+  svgHeader(w, canvas, canvas)
+  fmt.Fprintln(w, "<rect width=\"100%\" height=\"100%\" fill=\"#ffffff\"/>")
+  fmt.Fprintln(w, "<g stroke=\"#b0b0b0\" stroke-width=\"1\">")
+  var highlighted [][2]string
+  for _, e := range edges {
+    if slices.Contains(highlight, e[0]) && slices.Contains(highlight, e[1]) {
+      highlighted = append(highlighted, e)
+      continue
+    }
+    fmt.Fprintf(w, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\"/>\n", pos[e[0]].x+margin, pos[e[0]].y+margin, pos[e[1]].x+margin, pos[e[1]].y+margin)
+  }
+  fmt.Fprintln(w, "</g>")
+  fmt.Fprintln(w, "<g stroke=\"#dc143c\" stroke-width=\"2.5\">")
+  for _, e := range highlighted {
+    fmt.Fprintf(w, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\"/>\n", pos[e[0]].x+margin, pos[e[0]].y+margin, pos[e[1]].x+margin, pos[e[1]].y+margin)
+  }
+  fmt.Fprintln(w, "</g>")
+  fmt.Fprintln(w, "<g font-family=\"monospace\" font-size=\"10\" text-anchor=\"middle\">")
+  for _, n := range nodes {
+    fill := "#4682b4"
+    if slices.Contains(highlight, n) {
+      fill = "#dc143c"
+    }
+    x, y := pos[n].x+margin, pos[n].y+margin
+    fmt.Fprintf(w, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"5\" fill=\"%s\"><title>%s</title></circle>\n", x, y, fill, html.EscapeString(n))
+    fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", x, y-8, html.EscapeString(n))
+  }
+  fmt.Fprintln(w, "</g>")
+  fmt.Fprintln(w, "</svg>")
+  return w.Flush()
+}
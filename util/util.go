@@ -3,9 +3,11 @@ package util
 import (
   "errors"
   "fmt"
+  "os"
   "path/filepath"
   "runtime"
   "slices"
+  "strconv"
   "strings"
 )
 
@@ -34,6 +36,43 @@ func ProcessArgs(args []string) (string, bool, error) {
   return absInputsPath, debug, nil
 }
 
+func ArgValue(args []string, name string) (string, bool) {
+  for i, arg := range args {
+    if arg == name && i+1 < len(args) {
+      return args[i+1], true
+    }
+    if value, ok := strings.CutPrefix(arg, name+"="); ok {
+      return value, true
+    }
+  }
+  return "", false
+}
+
+func IntArg(args []string, name string, fallback int) (int, error) {
+  value, ok := ArgValue(args, name)
+  if !ok {
+    return fallback, nil
+  }
+  result, err := strconv.Atoi(value)
+  if err != nil {
+    return fallback, fmt.Errorf("Invalid value for %s: %s", name, value)
+  }
+  return result, nil
+}
+
+func OutputsPath(fileName string) (string, error) {
+  _, srcPath, _, ok := runtime.Caller(1)
+  if !ok {
+    return "", errors.New("Error getting the file path")
+  }
+  outputsDir := filepath.Join(filepath.Dir(srcPath), "outputs")
+  err := os.MkdirAll(outputsDir, 0755)
+  if err != nil {
+    return "", err
+  }
+  return filepath.Abs(filepath.Join(outputsDir, fileName))
+}
+
 func TurnRight(direction rune) rune {
   switch direction {
   case rune('^'):